@@ -1,37 +1,123 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
 
 	"github.com/Jonaires777/src/constants"
 	"github.com/Jonaires777/src/filemanager"
+	"github.com/Jonaires777/src/parser"
 	"github.com/Jonaires777/src/repl"
 )
 
 func main() {
 	if len(os.Args) > 1 && os.Args[1] == "debug" {
 		fmt.Println("Rodando modo debug...")
-		if err := filemanager.PrintSuperblock(); err != nil {
+		fsys, err := filemanager.MountReadOnly(constants.VirtualDisk)
+		if err != nil {
+			fmt.Println("Erro ao abrir o disco:", err)
+			os.Exit(1)
+		}
+		defer fsys.Close()
+
+		if err := fsys.PrintSuperblock(); err != nil {
 			fmt.Println("Erro ao imprimir superbloco:", err)
 		}
 
-		if err := filemanager.PrintBitmap(); err != nil {
+		if err := fsys.PrintBitmap(); err != nil {
 			fmt.Println("Erro ao imprimir bitmap:", err)
 		}
 
-		if err := filemanager.PrintInodeTable(); err != nil {
+		if err := fsys.PrintInodeTable(); err != nil {
 			fmt.Println("Erro ao imprimir tabela de inodes:", err)
 		}
 		return
 	}
 
-	if !filemanager.CheckFileExistence(constants.VirtualDisk) {
-		err := filemanager.CreateVirtualDisk(constants.VirtualDisk)
+	if len(os.Args) > 1 && os.Args[1] == "mkfs" {
+		if err := mkfs(os.Args[2:]); err != nil {
+			fmt.Println("Erro ao formatar o disco:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		repair := len(os.Args) > 2 && os.Args[2] == "--repair"
+		report, err := filemanager.Fsck(constants.VirtualDisk, repair)
 		if err != nil {
-			panic(err)
+			fmt.Println("Erro ao verificar o disco:", err)
+			os.Exit(1)
+		}
+
+		for _, problem := range report.Problems {
+			fmt.Println(" -", problem)
+		}
+
+		if len(report.Problems) == 0 {
+			fmt.Println("Nenhum problema encontrado")
+		} else if report.Repaired {
+			fmt.Printf("%d problemas encontrados e reparados\n", len(report.Problems))
+		} else {
+			fmt.Printf("%d problemas encontrados, use 'fsck --repair' para corrigir\n", len(report.Problems))
+			os.Exit(1)
 		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "upgrade" {
+		dryRun := len(os.Args) > 2 && os.Args[2] == "--dry-run"
+		report, err := filemanager.Upgrade(constants.VirtualDisk, dryRun)
+		if err != nil {
+			fmt.Println("Erro ao atualizar o disco:", err)
+			os.Exit(1)
+		}
+
+		if report.From == report.To {
+			fmt.Printf("Disco já está no layout mais recente (versão %d)\n", report.To)
+			return
+		}
+
+		for _, action := range report.Actions {
+			fmt.Println(" -", action)
+		}
+
+		if dryRun {
+			fmt.Printf("Simulação: layout %d seria atualizado para %d\n", report.From, report.To)
+		} else {
+			fmt.Printf("Disco atualizado do layout %d para %d\n", report.From, report.To)
+		}
+		return
+	}
+
+	flags := flag.NewFlagSet("jwfs", flag.ExitOnError)
+	cache := flags.String("cache", "8M", "memória do cache de blocos (aceita sufixos K, M e G; 0 desliga)")
+	readOnly := flags.Bool("read-only", false, "abrir o disco só para leitura, junto com outras sessões só de leitura")
+	flags.Parse(os.Args[1:])
+
+	cacheSize := int64(0)
+	if *cache != "0" {
+		size, err := parser.ParseSize(*cache)
+		if err != nil {
+			fmt.Println("Erro:", err)
+			os.Exit(1)
+		}
+		cacheSize = size
+	}
+
+	fsys, err := mountDisk(*readOnly)
+	if err != nil {
+		fmt.Println("Erro ao abrir o disco:", err)
+		os.Exit(1)
+	}
+	defer fsys.Close()
+
+	err = fsys.SetBufferCache(cacheSize)
+	if err != nil {
+		fmt.Println("Erro ao configurar o cache:", err)
+		os.Exit(1)
 	}
 
 	currentUser, err := user.Current()
@@ -40,9 +126,65 @@ func main() {
 	}
 
 	fmt.Printf("Hello, %s\n", currentUser.Username)
-	fmt.Println("Welcome to the virtual file system implementation in Go\n")
+	fmt.Print("Welcome to the virtual file system implementation in Go\n\n")
+
+	if fsys.ReadOnly() {
+		fmt.Print("Disco montado só para leitura\n\n")
+	}
+
+	fmt.Print("Use 'help' to see the available commands\n\n")
+
+	repl.Start(fsys)
+}
+
+// mountDisk monta o disco virtual, criando-o e reaplicando o journal se
+// preciso. Só para leitura, o disco precisa existir e o journal fica intacto.
+func mountDisk(readOnly bool) (*filemanager.FileSystem, error) {
+	if readOnly {
+		return filemanager.MountReadOnly(constants.VirtualDisk)
+	}
+
+	if !filemanager.CheckFileExistence(constants.VirtualDisk) {
+		err := filemanager.CreateVirtualDisk(constants.VirtualDisk)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	fsys, err := filemanager.Mount(constants.VirtualDisk)
+	if err != nil {
+		return nil, err
+	}
+	if replayed := fsys.Replayed(); replayed > 0 {
+		fmt.Printf("Journal reaplicado: %d blocos restaurados\n", replayed)
+	}
+	return fsys, nil
+}
+
+func mkfs(args []string) error {
+	flags := flag.NewFlagSet("mkfs", flag.ContinueOnError)
+	size := flags.String("size", "1G", "tamanho do disco (aceita sufixos K, M e G)")
+	blockSize := flags.Int64("block", constants.DefaultBlockSize, "tamanho do bloco em bytes")
+	inodes := flags.Int64("inodes", constants.DefaultMaxInodes, "quantidade máxima de inodes")
+	force := flags.Bool("force", false, "sobrescrever um disco existente")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	diskSize, err := parser.ParseSize(*size)
+	if err != nil {
+		return err
+	}
 
-	fmt.Println("Use 'help' to see the available commands\n")
+	if filemanager.CheckFileExistence(constants.VirtualDisk) && !*force {
+		return fmt.Errorf("%s já existe, use -force para sobrescrever", constants.VirtualDisk)
+	}
+
+	err = filemanager.FormatVirtualDisk(constants.VirtualDisk, diskSize, *blockSize, *inodes)
+	if err != nil {
+		return err
+	}
 
-	repl.Start()
+	fmt.Printf("Disco %s formatado: %d bytes, blocos de %d bytes, %d inodes\n", constants.VirtualDisk, diskSize, *blockSize, *inodes)
+	return nil
 }
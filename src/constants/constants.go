@@ -1,17 +1,36 @@
 package constants
 
+// Geometria usada quando o disco é criado sem mkfs; a geometria real de cada
+// imagem fica registrada no superbloco.
+const (
+	DefaultDiskSize      = 1 * 1024 * 1024 * 1024 // 1GB
+	DefaultBlockSize     = 4096
+	DefaultMaxInodes     = 1024
+	DefaultJournalBlocks = 256 // bloco de cabeçalho + imagens dos blocos de metadados
+	MinBlockSize         = 512
+	MaxBlockSize         = 64 * 1024
+	DefaultSortMemory    = 16 * 1024 * 1024 // memória de cada ordenação externa
+	IOBufferSize         = 256 * 1024       // buffer das leituras e cópias de dados em massa
+	DefaultBufferCache   = 8 * 1024 * 1024  // memória do cache de blocos do disco montado
+)
+
 const (
-	DiskSize        = 1 * 1024 * 1024 * 1024 // 1GB
 	VirtualDisk     = "virtual_disk.img"
-	InodeSize       = 64
-	MaxInodes       = 1024
-	BlockSize       = 4096
-	NumBlocks       = DiskSize / BlockSize
-	BitmapSize      = NumBlocks / 8
+	SuperBlockMagic = "JWFSDISK"
+	LayoutVersion   = 5 // a versão 1 é o layout original, sem assinatura
 	SuperBlockStart = 0
-	BitmapStart     = BlockSize
-	InodeTableStart = BitmapStart + BitmapSize
-	InodeTableSize  = MaxInodes * InodeSize
-	DataStart       = InodeTableStart + InodeTableSize
+	SuperBlockSize  = 128
+	InodeSize       = 256
 	MaxFilenameLen  = 32
+	MaxExtents      = 16
+	ExtentsStart    = 128 // deslocamento da lista de extents dentro do inode
+	RootInode       = 0
+	DirEntrySize    = 64 // nome (32) + inode (8), alinhado para não cruzar blocos
+	DefaultFileMode = 0644
+	DefaultDirMode  = 0755
+
+	AccountRecordSize  = 128    // nome (32) + tipo, marcas, ids, salt, hash e custo da senha
+	PasswordIterations = 600000 // rodadas do PBKDF2-HMAC-SHA256 das senhas novas
+	RootUID            = 0
+	RootGID            = 0
 )
@@ -0,0 +1,321 @@
+package device
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+)
+
+// BufferStats conta os acessos a um BufferCache. Writes é o número de
+// gravações feitas no dispositivo e WrittenBlocks o de blocos gravados por
+// elas: blocos sujos vizinhos são gravados juntos.
+type BufferStats struct {
+	Capacity      int
+	Blocks        int
+	Dirty         int
+	Hits          int64
+	Misses        int64
+	Evictions     int64
+	Writes        int64
+	WrittenBlocks int64
+}
+
+// BufferCache guarda em memória até capacity blocos de outro dispositivo,
+// descartando os usados há mais tempo. As gravações ficam no cache até Sync,
+// Flush ou até o bloco ser descartado. Acessos com um tamanho de bloco
+// diferente de blockSize vão direto ao dispositivo.
+type BufferCache struct {
+	mu        sync.Mutex
+	dev       BlockDevice
+	blockSize int64
+	capacity  int
+
+	// lru tem os blocos do mais recente ao mais antigo
+	lru    *list.List
+	blocks map[int64]*list.Element
+	stats  BufferStats
+}
+
+type buffer struct {
+	index int64
+	data  []byte
+	dirty bool
+}
+
+func NewBufferCache(dev BlockDevice, blockSize int64, capacity int) *BufferCache {
+	return &BufferCache{
+		dev:       dev,
+		blockSize: blockSize,
+		capacity:  max(capacity, 0),
+		lru:       list.New(),
+		blocks:    make(map[int64]*list.Element),
+	}
+}
+
+func (c *BufferCache) ReadBlock(index int64, p []byte) error {
+	return c.ReadBlocks(index, 1, p)
+}
+
+func (c *BufferCache) WriteBlock(index int64, p []byte) error {
+	return c.WriteBlocks(index, 1, p)
+}
+
+// ReadBlocks copia os blocos presentes no cache e lê cada sequência de blocos
+// ausentes em uma única chamada ao dispositivo.
+func (c *BufferCache) ReadBlocks(index int64, count int, p []byte) error {
+	if err := checkBlocks(c, index, count, p); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int64(len(p)/count) != c.blockSize {
+		err := c.flush()
+		if err != nil {
+			return err
+		}
+		return c.dev.ReadBlocks(index, count, p)
+	}
+
+	for i := 0; i < count; {
+		if elem, ok := c.blocks[index+int64(i)]; ok {
+			c.lru.MoveToFront(elem)
+			copy(c.block(p, i), elem.Value.(*buffer).data)
+			c.stats.Hits++
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < count && c.blocks[index+int64(end)] == nil {
+			end++
+		}
+		err := c.dev.ReadBlocks(index+int64(i), end-i, p[int64(i)*c.blockSize:int64(end)*c.blockSize])
+		if err != nil {
+			return err
+		}
+		c.stats.Misses += int64(end - i)
+
+		for ; i < end; i++ {
+			err = c.insert(index+int64(i), c.block(p, i), false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteBlocks só atualiza o cache; os blocos chegam ao dispositivo quando são
+// descartados ou no próximo Flush.
+func (c *BufferCache) WriteBlocks(index int64, count int, p []byte) error {
+	if err := checkBlocks(c, index, count, p); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int64(len(p)/count) != c.blockSize {
+		err := c.flush()
+		if err != nil {
+			return err
+		}
+		c.lru.Init()
+		clear(c.blocks)
+		return c.dev.WriteBlocks(index, count, p)
+	}
+
+	// Sem espaço para os blocos, a gravação vai direto ao dispositivo e as
+	// cópias em cache são atualizadas.
+	if count > c.capacity {
+		for i := range count {
+			if elem, ok := c.blocks[index+int64(i)]; ok {
+				buf := elem.Value.(*buffer)
+				copy(buf.data, c.block(p, i))
+				buf.dirty = false
+			}
+		}
+		c.stats.Writes++
+		c.stats.WrittenBlocks += int64(count)
+		return c.dev.WriteBlocks(index, count, p)
+	}
+
+	for i := range count {
+		err := c.insert(index+int64(i), c.block(p, i), true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *BufferCache) block(p []byte, i int) []byte {
+	return p[int64(i)*c.blockSize : int64(i+1)*c.blockSize]
+}
+
+// insert guarda uma cópia de data como o bloco index, descartando o bloco
+// usado há mais tempo se o cache estiver cheio.
+func (c *BufferCache) insert(index int64, data []byte, dirty bool) error {
+	if elem, ok := c.blocks[index]; ok {
+		buf := elem.Value.(*buffer)
+		copy(buf.data, data)
+		buf.dirty = buf.dirty || dirty
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+
+	if c.capacity == 0 {
+		return nil
+	}
+
+	var buf *buffer
+	if c.lru.Len() >= c.capacity {
+		var err error
+		buf, err = c.evict()
+		if err != nil {
+			return err
+		}
+	} else {
+		buf = &buffer{data: make([]byte, c.blockSize)}
+	}
+
+	buf.index = index
+	buf.dirty = dirty
+	copy(buf.data, data)
+	c.blocks[index] = c.lru.PushFront(buf)
+	return nil
+}
+
+// evict descarta o bloco usado há mais tempo, gravando-o antes se estiver
+// sujo, e devolve o seu buffer para ser reaproveitado.
+func (c *BufferCache) evict() (*buffer, error) {
+	elem := c.lru.Back()
+	buf := elem.Value.(*buffer)
+	if buf.dirty {
+		err := c.writeBack(buf.index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.lru.Remove(elem)
+	delete(c.blocks, buf.index)
+	c.stats.Evictions++
+	return buf, nil
+}
+
+// writeBack grava o bloco sujo index junto com os blocos sujos vizinhos, em
+// uma única chamada, e os marca como limpos.
+func (c *BufferCache) writeBack(index int64) error {
+	start, end := index, index+1
+	for c.isDirty(start - 1) {
+		start--
+	}
+	for c.isDirty(end) {
+		end++
+	}
+
+	data := make([]byte, 0, (end-start)*c.blockSize)
+	for i := start; i < end; i++ {
+		data = append(data, c.blocks[i].Value.(*buffer).data...)
+	}
+	err := c.dev.WriteBlocks(start, int(end-start), data)
+	if err != nil {
+		return err
+	}
+
+	for i := start; i < end; i++ {
+		c.blocks[i].Value.(*buffer).dirty = false
+	}
+	c.stats.Writes++
+	c.stats.WrittenBlocks += end - start
+	return nil
+}
+
+func (c *BufferCache) isDirty(index int64) bool {
+	elem, ok := c.blocks[index]
+	return ok && elem.Value.(*buffer).dirty
+}
+
+// Flush grava no dispositivo todos os blocos sujos, sem chamar Sync.
+func (c *BufferCache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+func (c *BufferCache) flush() error {
+	var dirty []int64
+	for index, elem := range c.blocks {
+		if elem.Value.(*buffer).dirty {
+			dirty = append(dirty, index)
+		}
+	}
+	slices.Sort(dirty)
+
+	for _, index := range dirty {
+		if !c.isDirty(index) {
+			continue
+		}
+		err := c.writeBack(index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync grava os blocos sujos e sincroniza o dispositivo.
+func (c *BufferCache) Sync() error {
+	err := c.Flush()
+	if err != nil {
+		return err
+	}
+	return c.dev.Sync()
+}
+
+func (c *BufferCache) Size() int64 {
+	return c.dev.Size()
+}
+
+// Resize muda a capacidade do cache, descartando os blocos que não cabem mais.
+func (c *BufferCache) Resize(capacity int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = max(capacity, 0)
+	for c.lru.Len() > c.capacity {
+		_, err := c.evict()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *BufferCache) Stats() BufferStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Capacity = c.capacity
+	stats.Blocks = c.lru.Len()
+	for _, elem := range c.blocks {
+		if elem.Value.(*buffer).dirty {
+			stats.Dirty++
+		}
+	}
+	return stats
+}
+
+// Close grava os blocos sujos e fecha o dispositivo, se ele puder ser fechado.
+func (c *BufferCache) Close() error {
+	err := c.Flush()
+	if closer, ok := c.dev.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package device
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferCache(t *testing.T) {
+	testDevice(t, NewBufferCache(NewMemoryDevice(8*512), 512, 4))
+	testDevice(t, NewBufferCache(NewMemoryDevice(8*512), 512, 0))
+
+	dev := NewMemoryDevice(16 * 512)
+	cache := NewBufferCache(dev, 512, 4)
+
+	blocks := bytes.Repeat([]byte{1}, 3*512)
+	err := cache.WriteBlocks(2, 3, blocks)
+	if err != nil {
+		t.Fatalf("WriteBlocks: %v", err)
+	}
+
+	got := make([]byte, 512)
+	err = dev.ReadBlock(3, got)
+	if err != nil || got[0] != 0 {
+		t.Fatalf("gravação chegou ao dispositivo antes do Flush: %v", err)
+	}
+
+	err = cache.ReadBlock(3, got)
+	if err != nil || got[0] != 1 {
+		t.Fatalf("leitura não veio do cache: %v", err)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Dirty != 3 {
+		t.Fatalf("estatísticas inesperadas: %+v", stats)
+	}
+
+	// Dois blocos novos descartam o bloco 2, o menos usado; ele e os vizinhos
+	// sujos vão ao dispositivo em uma só gravação.
+	err = cache.ReadBlocks(10, 2, make([]byte, 2*512))
+	if err != nil {
+		t.Fatalf("ReadBlocks: %v", err)
+	}
+	stats := cache.Stats()
+	if stats.Evictions != 1 || stats.Writes != 1 || stats.WrittenBlocks != 3 || stats.Dirty != 0 || stats.Misses != 2 {
+		t.Fatalf("estatísticas após o descarte: %+v", stats)
+	}
+	err = dev.ReadBlock(4, got)
+	if err != nil || got[0] != 1 {
+		t.Fatalf("bloco vizinho não foi gravado: %v", err)
+	}
+
+	err = cache.WriteBlock(12, bytes.Repeat([]byte{2}, 512))
+	if err != nil {
+		t.Fatalf("WriteBlock: %v", err)
+	}
+	err = cache.Resize(1)
+	if err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if stats := cache.Stats(); stats.Blocks != 1 || stats.Dirty != 1 {
+		t.Fatalf("estatísticas após reduzir o cache: %+v", stats)
+	}
+
+	err = cache.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	err = dev.ReadBlock(12, got)
+	if err != nil || got[0] != 2 {
+		t.Fatalf("Sync não gravou o bloco sujo: %v", err)
+	}
+}
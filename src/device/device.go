@@ -0,0 +1,187 @@
+package device
+
+import (
+	"errors"
+	"os"
+)
+
+// BlockDevice é o meio onde uma imagem jwfs é gravada. O tamanho do bloco é
+// dado pelo tamanho de p, o que permite ler o superbloco antes de conhecer a
+// geometria do disco. ReadBlocks e WriteBlocks transferem count blocos
+// contíguos em uma única chamada, com blocos de len(p)/count bytes.
+type BlockDevice interface {
+	ReadBlock(index int64, p []byte) error
+	WriteBlock(index int64, p []byte) error
+	ReadBlocks(index int64, count int, p []byte) error
+	WriteBlocks(index int64, count int, p []byte) error
+	Sync() error
+	Size() int64
+}
+
+var ErrOutOfRange = errors.New("bloco fora dos limites do dispositivo")
+
+func checkRange(dev BlockDevice, index int64, p []byte) error {
+	return checkBlocks(dev, index, 1, p)
+}
+
+// checkBlocks verifica se os count blocos de p cabem no dispositivo.
+func checkBlocks(dev BlockDevice, index int64, count int, p []byte) error {
+	if index < 0 || count <= 0 || len(p) == 0 || len(p)%count != 0 {
+		return ErrOutOfRange
+	}
+	if blockSize := int64(len(p) / count); (index+int64(count))*blockSize > dev.Size() {
+		return ErrOutOfRange
+	}
+	return nil
+}
+
+type FileDevice struct {
+	file *os.File
+	size int64
+}
+
+// OpenFileDevice abre a imagem e a trava contra outros processos: com
+// exclusividade se flag permite gravar, de forma compartilhada se só lê.
+func OpenFileDevice(filename string, flag int) (*FileDevice, error) {
+	file, err := os.OpenFile(filename, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file, flag&(os.O_WRONLY|os.O_RDWR) != 0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &FileDevice{file: file, size: info.Size()}, nil
+}
+
+// CreateFileDevice cria ou zera a imagem. O arquivo só é truncado depois de
+// travado, para não apagar uma imagem em uso por outro processo.
+func CreateFileDevice(filename string, size int64) (*FileDevice, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file, true)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Como em os.Create, o conteúdo anterior é descartado.
+	err = file.Truncate(0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	err = file.Truncate(size)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &FileDevice{file: file, size: size}, nil
+}
+
+func (d *FileDevice) ReadBlock(index int64, p []byte) error {
+	if err := checkRange(d, index, p); err != nil {
+		return err
+	}
+	_, err := d.file.ReadAt(p, index*int64(len(p)))
+	return err
+}
+
+func (d *FileDevice) WriteBlock(index int64, p []byte) error {
+	if err := checkRange(d, index, p); err != nil {
+		return err
+	}
+	_, err := d.file.WriteAt(p, index*int64(len(p)))
+	return err
+}
+
+func (d *FileDevice) ReadBlocks(index int64, count int, p []byte) error {
+	if err := checkBlocks(d, index, count, p); err != nil {
+		return err
+	}
+	_, err := d.file.ReadAt(p, index*int64(len(p)/count))
+	return err
+}
+
+func (d *FileDevice) WriteBlocks(index int64, count int, p []byte) error {
+	if err := checkBlocks(d, index, count, p); err != nil {
+		return err
+	}
+	_, err := d.file.WriteAt(p, index*int64(len(p)/count))
+	return err
+}
+
+func (d *FileDevice) Sync() error {
+	return d.file.Sync()
+}
+
+func (d *FileDevice) Size() int64 {
+	return d.size
+}
+
+func (d *FileDevice) Close() error {
+	return d.file.Close()
+}
+
+// MemoryDevice guarda a imagem inteira em memória; útil em testes.
+type MemoryDevice struct {
+	data []byte
+}
+
+func NewMemoryDevice(size int64) *MemoryDevice {
+	return &MemoryDevice{data: make([]byte, size)}
+}
+
+func (d *MemoryDevice) ReadBlock(index int64, p []byte) error {
+	if err := checkRange(d, index, p); err != nil {
+		return err
+	}
+	copy(p, d.data[index*int64(len(p)):])
+	return nil
+}
+
+func (d *MemoryDevice) WriteBlock(index int64, p []byte) error {
+	if err := checkRange(d, index, p); err != nil {
+		return err
+	}
+	copy(d.data[index*int64(len(p)):], p)
+	return nil
+}
+
+func (d *MemoryDevice) ReadBlocks(index int64, count int, p []byte) error {
+	if err := checkBlocks(d, index, count, p); err != nil {
+		return err
+	}
+	copy(p, d.data[index*int64(len(p)/count):])
+	return nil
+}
+
+func (d *MemoryDevice) WriteBlocks(index int64, count int, p []byte) error {
+	if err := checkBlocks(d, index, count, p); err != nil {
+		return err
+	}
+	copy(d.data[index*int64(len(p)/count):], p)
+	return nil
+}
+
+func (d *MemoryDevice) Sync() error {
+	return nil
+}
+
+func (d *MemoryDevice) Size() int64 {
+	return int64(len(d.data))
+}
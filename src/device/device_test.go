@@ -0,0 +1,120 @@
+package device
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func testDevice(t *testing.T, dev BlockDevice) {
+	t.Helper()
+
+	block := bytes.Repeat([]byte{0xAB}, 512)
+	err := dev.WriteBlock(3, block)
+	if err != nil {
+		t.Fatalf("WriteBlock: %v", err)
+	}
+
+	got := make([]byte, 512)
+	err = dev.ReadBlock(3, got)
+	if err != nil {
+		t.Fatalf("ReadBlock: %v", err)
+	}
+	if !bytes.Equal(got, block) {
+		t.Fatal("bloco lido difere do gravado")
+	}
+
+	err = dev.ReadBlock(dev.Size()/512, got)
+	if err != ErrOutOfRange {
+		t.Fatalf("leitura fora dos limites: %v", err)
+	}
+
+	blocks := make([]byte, 3*512)
+	for i := range blocks {
+		blocks[i] = byte(i / 512)
+	}
+	err = dev.WriteBlocks(4, 3, blocks)
+	if err != nil {
+		t.Fatalf("WriteBlocks: %v", err)
+	}
+
+	err = dev.ReadBlock(5, got)
+	if err != nil || !bytes.Equal(got, blocks[512:1024]) {
+		t.Fatalf("bloco gravado por WriteBlocks: %v", err)
+	}
+
+	all := make([]byte, 5*512)
+	err = dev.ReadBlocks(3, 5, all)
+	if err != nil || !bytes.Equal(all[:512], block) || !bytes.Equal(all[512:2048], blocks) {
+		t.Fatalf("ReadBlocks: %v", err)
+	}
+
+	err = dev.ReadBlocks(dev.Size()/512-2, 3, blocks)
+	if err != ErrOutOfRange {
+		t.Fatalf("leitura de vários blocos fora dos limites: %v", err)
+	}
+
+	err = dev.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+}
+
+func TestMemoryDevice(t *testing.T) {
+	testDevice(t, NewMemoryDevice(8*512))
+}
+
+func TestFileDevice(t *testing.T) {
+	dev, err := CreateFileDevice(filepath.Join(t.TempDir(), "disk.img"), 8*512)
+	if err != nil {
+		t.Fatalf("CreateFileDevice: %v", err)
+	}
+	defer dev.Close()
+
+	testDevice(t, dev)
+}
+
+func TestFileDeviceLock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "disk.img")
+	dev, err := CreateFileDevice(filename, 8*512)
+	if err != nil {
+		t.Fatalf("CreateFileDevice: %v", err)
+	}
+
+	// Descritores diferentes disputam a trava mesmo dentro de um processo.
+	_, err = OpenFileDevice(filename, os.O_RDONLY)
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || !errors.Is(err, ErrLocked) {
+		t.Fatalf("leitura de imagem travada para escrita: %v", err)
+	}
+	if runtime.GOOS == "linux" && !slices.Contains(lockErr.PIDs, os.Getpid()) {
+		t.Errorf("erro não identifica o dono da trava: %v", err)
+	}
+
+	_, err = CreateFileDevice(filename, 8*512)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("CreateFileDevice sobre imagem travada: %v", err)
+	}
+	dev.Close()
+
+	// Leitores compartilham a imagem, mas impedem quem quer gravar.
+	reader1, err := OpenFileDevice(filename, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("OpenFileDevice: %v", err)
+	}
+	defer reader1.Close()
+	reader2, err := OpenFileDevice(filename, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("segundo leitor: %v", err)
+	}
+	defer reader2.Close()
+
+	_, err = OpenFileDevice(filename, os.O_RDWR)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("escrita em imagem aberta por leitores: %v", err)
+	}
+}
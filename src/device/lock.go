@@ -0,0 +1,40 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrLocked = errors.New("imagem em uso por outro processo")
+
+// LockError é devolvido quando outro processo tem uma trava incompatível
+// sobre a imagem. PIDs lista os donos conhecidos da trava; Stale, os que já
+// terminaram, caso em que a trava continua presa a um descritor herdado por
+// algum processo filho.
+type LockError struct {
+	Path  string
+	PIDs  []int
+	Stale []int
+}
+
+func (e *LockError) Error() string {
+	if len(e.PIDs) == 0 {
+		return fmt.Sprintf("%s: %v", e.Path, ErrLocked)
+	}
+
+	owners := make([]string, len(e.PIDs))
+	for i, pid := range e.PIDs {
+		owners[i] = strconv.Itoa(pid)
+	}
+	msg := fmt.Sprintf("%s: %v (PID %s)", e.Path, ErrLocked, strings.Join(owners, ", "))
+	if len(e.Stale) > 0 {
+		msg += "; o processo que pegou a trava já terminou e ela foi herdada por um processo filho"
+	}
+	return msg
+}
+
+func (e *LockError) Unwrap() error {
+	return ErrLocked
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package device
+
+import "os"
+
+// Sem flock, a imagem fica sem trava.
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package device
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockFile pega uma trava flock sobre a imagem, exclusiva para quem grava e
+// compartilhada para quem só lê. O kernel a solta quando o arquivo é fechado
+// ou o processo termina.
+func lockFile(file *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		lockErr := &LockError{Path: file.Name()}
+		lockErr.PIDs, lockErr.Stale = lockHolders(file)
+		return lockErr
+	}
+	return err
+}
+
+// lockHolders procura em /proc/locks, que só existe no Linux, os processos
+// com travas flock sobre o arquivo. Um PID que não existe mais indica uma
+// trava herdada: o processo que a pegou terminou, mas um filho ainda tem o
+// descritor aberto.
+func lockHolders(file *os.File) (pids, stale []int) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, nil
+	}
+	dev := uint64(st.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	id := fmt.Sprintf("%02x:%02x:%d", major, minor, st.Ino)
+
+	locks, err := os.Open("/proc/locks")
+	if err != nil {
+		return nil, nil
+	}
+	defer locks.Close()
+
+	// 1: FLOCK  ADVISORY  WRITE 1234 fe:00:9617421 0 EOF
+	scanner := bufio.NewScanner(locks)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] != "FLOCK" || fields[5] != id {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil {
+			continue
+		}
+
+		pids = append(pids, pid)
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			stale = append(stale, pid)
+		}
+	}
+	return pids, stale
+}
@@ -0,0 +1,558 @@
+package filemanager
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+const (
+	AccountUser uint8 = iota + 1
+	AccountGroup
+)
+
+// AccountEmptyPassword marca um usuário que entra sem senha porque isso foi
+// pedido explicitamente. Um usuário sem senha e sem essa marca nunca teve uma
+// senha definida e precisa definir uma no primeiro login.
+const AccountEmptyPassword uint8 = 1
+
+var (
+	ErrNoPassword    = errors.New("usuário sem senha definida")
+	ErrEmptyPassword = errors.New("senha vazia não é permitida")
+	ErrLogin         = errors.New("usuário ou senha inválidos")
+)
+
+// Account é um registro da tabela de contas, usada tanto para usuários quanto
+// para grupos. GID é o grupo principal de um usuário; em grupos ele é ignorado.
+// Hash é o PBKDF2-HMAC-SHA256 da senha com Salt e Iterations rodadas e fica
+// zerado em contas sem senha. Iterations zero indica o formato antigo,
+// sha256(Salt + senha), que é trocado no próximo login.
+type Account struct {
+	Name       [32]byte
+	Kind       uint8
+	Flags      uint8
+	ID         uint32
+	GID        uint32
+	Salt       [16]byte
+	Hash       [32]byte
+	Iterations uint32
+}
+
+func (account *Account) name() string {
+	end := bytes.IndexByte(account.Name[:], 0)
+	if end < 0 {
+		end = len(account.Name)
+	}
+	return string(account.Name[:end])
+}
+
+func (account *Account) hasPassword() bool {
+	return account.Hash != [32]byte{}
+}
+
+// setPassword troca a senha. Uma senha vazia só é aceita com allowEmpty.
+func (account *Account) setPassword(password string, allowEmpty bool) error {
+	if password == "" {
+		if !allowEmpty {
+			return ErrEmptyPassword
+		}
+		account.Salt = [16]byte{}
+		account.Hash = [32]byte{}
+		account.Iterations = 0
+		account.Flags |= AccountEmptyPassword
+		return nil
+	}
+
+	account.Flags &^= AccountEmptyPassword
+	_, err := rand.Read(account.Salt[:])
+	if err != nil {
+		return err
+	}
+	account.Iterations = constants.PasswordIterations
+	account.Hash = pbkdf2SHA256([]byte(password), account.Salt[:], account.Iterations)
+	return nil
+}
+
+func (account *Account) checkPassword(password string) bool {
+	if !account.hasPassword() {
+		return password == "" && account.Flags&AccountEmptyPassword != 0
+	}
+
+	var hash [32]byte
+	if account.Iterations == 0 {
+		hash = sha256.Sum256(append(account.Salt[:], password...))
+	} else {
+		hash = pbkdf2SHA256([]byte(password), account.Salt[:], account.Iterations)
+	}
+	return subtle.ConstantTimeCompare(hash[:], account.Hash[:]) == 1
+}
+
+// pbkdf2SHA256 é o PBKDF2 da RFC 8018 com HMAC-SHA256, limitado a uma chave
+// do tamanho de um bloco do hash, que é o que o registro guarda.
+func pbkdf2SHA256(password, salt []byte, iterations uint32) [32]byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+
+	var key [32]byte
+	copy(key[:], u)
+	for range iterations - 1 {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		subtle.XORBytes(key[:], key[:], u)
+	}
+	return key
+}
+
+func serializeAccount(account Account) []byte {
+	data := make([]byte, constants.AccountRecordSize)
+	copy(data[:32], account.Name[:])
+	data[32] = account.Kind
+	data[33] = account.Flags
+	binary.LittleEndian.PutUint32(data[36:40], account.ID)
+	binary.LittleEndian.PutUint32(data[40:44], account.GID)
+	copy(data[44:60], account.Salt[:])
+	copy(data[60:92], account.Hash[:])
+	binary.LittleEndian.PutUint32(data[92:96], account.Iterations)
+	return data
+}
+
+func deserializeAccount(data []byte) Account {
+	var account Account
+	copy(account.Name[:], data[:32])
+	account.Kind = data[32]
+	account.Flags = data[33]
+	account.ID = binary.LittleEndian.Uint32(data[36:40])
+	account.GID = binary.LittleEndian.Uint32(data[40:44])
+	copy(account.Salt[:], data[44:60])
+	copy(account.Hash[:], data[60:92])
+	account.Iterations = binary.LittleEndian.Uint32(data[92:96])
+	return account
+}
+
+func defaultAccounts() []Account {
+	user := Account{Kind: AccountUser, ID: constants.RootUID, GID: constants.RootGID}
+	copy(user.Name[:], "root")
+	group := Account{Kind: AccountGroup, ID: constants.RootGID}
+	copy(group.Name[:], "root")
+	return []Account{user, group}
+}
+
+func findAccount(accounts []Account, kind uint8, name string) (int, bool) {
+	for i := range accounts {
+		if accounts[i].Kind == kind && accounts[i].name() == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func findAccountID(accounts []Account, kind uint8, id uint32) (int, bool) {
+	for i := range accounts {
+		if accounts[i].Kind == kind && accounts[i].ID == id {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// readAccounts devolve a tabela de contas. Uma tabela sem o usuário root, como
+// a recriada vazia pelo fsck, volta a ter um root sem senha, que a define no
+// primeiro login.
+func (tx *transaction) readAccounts() ([]Account, error) {
+	var accounts []Account
+
+	if ino := tx.fsys.sb.AccountsInode; ino != constants.RootInode {
+		inode, err := tx.readInode(ino)
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, constants.AccountRecordSize)
+		for i := int64(0); i < inode.Size; i++ {
+			offset, err := inode.dataOffset(tx.fsys.sb.BlockSize, i*constants.AccountRecordSize)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.ReadAt(data, offset)
+			if err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, deserializeAccount(data))
+		}
+	}
+
+	for _, account := range defaultAccounts() {
+		if _, ok := findAccountID(accounts, account.Kind, account.ID); !ok {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+// writeAccounts regrava a tabela inteira, alocando no bitmap em memória os
+// blocos que faltarem.
+func (tx *transaction) writeAccounts(bitmap []byte, accounts []Account) error {
+	ino := tx.fsys.sb.AccountsInode
+	if ino == constants.RootInode {
+		return errors.New("disco sem tabela de contas")
+	}
+
+	inode, err := tx.readInode(ino)
+	if err != nil {
+		return err
+	}
+
+	needed := ceilDiv(int64(len(accounts))*constants.AccountRecordSize, tx.fsys.sb.BlockSize)
+	if have := totalBlocks(inode.Extents); needed > have {
+		extents, err := tx.fsys.allocateExtents(bitmap, needed-have)
+		if err != nil {
+			return err
+		}
+
+		inode.Extents, err = appendExtents(inode.Extents, extents)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, account := range accounts {
+		offset, err := inode.dataOffset(tx.fsys.sb.BlockSize, int64(i)*constants.AccountRecordSize)
+		if err != nil {
+			return err
+		}
+		_, err = tx.WriteAt(serializeAccount(account), offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	inode.Size = int64(len(accounts))
+	inode.Mtime = time.Now().UnixNano()
+	return tx.writeInode(ino, inode)
+}
+
+// createAccountsTable grava no inode ino uma tabela só com o usuário e o grupo
+// root. O superbloco precisa já apontar para ino.
+func (tx *transaction) createAccountsTable(ino int64) error {
+	inode := newInode("", TypeAccounts, constants.RootUID, constants.RootGID)
+	inode.Mode = 0600
+	err := tx.writeInode(ino, inode)
+	if err != nil {
+		return err
+	}
+
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeAccounts(bitmap, defaultAccounts())
+	if err != nil {
+		return err
+	}
+
+	return tx.writeBitmap(bitmap)
+}
+
+func InitializeAccounts(dev device.BlockDevice) error {
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		return err
+	}
+
+	tx := fsys.begin()
+	err = tx.createAccountsTable(fsys.sb.AccountsInode)
+	if err != nil {
+		return err
+	}
+
+	err = tx.commit()
+	if err != nil {
+		return err
+	}
+	return fsys.Sync()
+}
+
+// Login troca o usuário da montagem; arquivos criados a partir daqui pertencem
+// a ele e as permissões passam a ser verificadas contra ele. Um usuário que
+// nunca teve senha recebe ErrNoPassword e precisa passar por
+// SetInitialPassword.
+//
+// A senha é conferida fora de mu, porque o PBKDF2 é lento de propósito. Um
+// usuário inexistente custa o mesmo que uma senha errada e recebe o mesmo
+// erro, para que nem a mensagem nem o tempo revelem quais nomes existem.
+func (fsys *FileSystem) Login(name, password string) error {
+	fsys.mu.Lock()
+	accounts, err := fsys.begin().readAccounts()
+	fsys.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	i, ok := findAccount(accounts, AccountUser, name)
+	if ok && !accounts[i].hasPassword() && accounts[i].Flags&AccountEmptyPassword == 0 {
+		return ErrNoPassword
+	}
+	if !ok {
+		pbkdf2SHA256([]byte(password), nil, constants.PasswordIterations)
+		return ErrLogin
+	}
+	if !accounts[i].checkPassword(password) {
+		return ErrLogin
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if accounts[i].hasPassword() && accounts[i].Iterations == 0 && !fsys.readOnly {
+		err = fsys.rehashPassword(accounts[i], password)
+		if err != nil {
+			return err
+		}
+	}
+
+	fsys.uid = accounts[i].ID
+	fsys.gid = accounts[i].GID
+	return nil
+}
+
+// rehashPassword regrava no formato atual a senha de uma conta que ainda usa
+// o antigo, se ela não mudou desde que foi conferida.
+func (fsys *FileSystem) rehashPassword(account Account, password string) error {
+	tx := fsys.begin()
+
+	accounts, err := tx.readAccounts()
+	if err != nil {
+		return err
+	}
+
+	i, ok := findAccountID(accounts, AccountUser, account.ID)
+	if !ok || accounts[i].Hash != account.Hash {
+		return nil
+	}
+
+	err = accounts[i].setPassword(password, false)
+	if err != nil {
+		return err
+	}
+	return tx.saveAccounts(accounts)
+}
+
+// SetInitialPassword define a senha de um usuário que nunca teve uma, como o
+// root de um disco recém-formatado, e entra com ele.
+func (fsys *FileSystem) SetInitialPassword(name, password string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+
+	accounts, err := tx.readAccounts()
+	if err != nil {
+		return err
+	}
+
+	i, ok := findAccount(accounts, AccountUser, name)
+	if !ok {
+		return errors.New("usuário não encontrado")
+	}
+	if accounts[i].hasPassword() || accounts[i].Flags&AccountEmptyPassword != 0 {
+		return errors.New("usuário já tem senha definida")
+	}
+
+	err = accounts[i].setPassword(password, false)
+	if err != nil {
+		return err
+	}
+
+	err = tx.saveAccounts(accounts)
+	if err != nil {
+		return err
+	}
+
+	fsys.uid = accounts[i].ID
+	fsys.gid = accounts[i].GID
+	return nil
+}
+
+// Whoami devolve os nomes do usuário atual e do seu grupo principal.
+func (fsys *FileSystem) Whoami() (string, string) {
+	fsys.mu.Lock()
+	uid, gid := fsys.uid, fsys.gid
+	fsys.mu.Unlock()
+	return fsys.OwnerNames(uid, gid)
+}
+
+// OwnerNames traduz uid e gid para nomes, usando os números quando a conta
+// não existe mais.
+func (fsys *FileSystem) OwnerNames(uid, gid uint32) (string, string) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	user := strconv.FormatUint(uint64(uid), 10)
+	group := strconv.FormatUint(uint64(gid), 10)
+
+	accounts, err := fsys.begin().readAccounts()
+	if err != nil {
+		return user, group
+	}
+
+	if i, ok := findAccountID(accounts, AccountUser, uid); ok {
+		user = accounts[i].name()
+	}
+	if i, ok := findAccountID(accounts, AccountGroup, gid); ok {
+		group = accounts[i].name()
+	}
+	return user, group
+}
+
+func validAccountName(name string) error {
+	if name == "" || len(name) >= constants.MaxFilenameLen {
+		return errors.New("nome de conta inválido")
+	}
+	return nil
+}
+
+// nextID devolve o menor id livre a partir de 1000 para o tipo de conta.
+func nextID(accounts []Account, kind uint8) uint32 {
+	id := uint32(1000)
+	for _, account := range accounts {
+		if account.Kind == kind && account.ID >= id {
+			id = account.ID + 1
+		}
+	}
+	return id
+}
+
+func (fsys *FileSystem) AddGroup(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if fsys.uid != constants.RootUID {
+		return ErrPermission
+	}
+	if err := validAccountName(name); err != nil {
+		return err
+	}
+
+	tx := fsys.begin()
+
+	accounts, err := tx.readAccounts()
+	if err != nil {
+		return err
+	}
+	if _, ok := findAccount(accounts, AccountGroup, name); ok {
+		return errors.New("grupo já existe")
+	}
+
+	group := Account{Kind: AccountGroup, ID: nextID(accounts, AccountGroup)}
+	copy(group.Name[:], name)
+
+	return tx.saveAccounts(append(accounts, group))
+}
+
+// AddUser cria um usuário com a senha dada, que só pode ser vazia com
+// allowEmpty. Sem group, é criado um grupo com o mesmo nome do usuário para
+// ser o seu grupo principal.
+func (fsys *FileSystem) AddUser(name, group, password string, allowEmpty bool) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if fsys.uid != constants.RootUID {
+		return ErrPermission
+	}
+	if err := validAccountName(name); err != nil {
+		return err
+	}
+
+	tx := fsys.begin()
+
+	accounts, err := tx.readAccounts()
+	if err != nil {
+		return err
+	}
+	if _, ok := findAccount(accounts, AccountUser, name); ok {
+		return errors.New("usuário já existe")
+	}
+
+	user := Account{Kind: AccountUser, ID: nextID(accounts, AccountUser)}
+	copy(user.Name[:], name)
+	err = user.setPassword(password, allowEmpty)
+	if err != nil {
+		return err
+	}
+
+	if group == "" {
+		if _, ok := findAccount(accounts, AccountGroup, name); ok {
+			return errors.New("grupo já existe, informe o grupo do usuário")
+		}
+		newGroup := Account{Kind: AccountGroup, ID: nextID(accounts, AccountGroup)}
+		copy(newGroup.Name[:], name)
+		accounts = append(accounts, newGroup)
+		user.GID = newGroup.ID
+	} else {
+		i, ok := findAccount(accounts, AccountGroup, group)
+		if !ok {
+			return errors.New("grupo não encontrado")
+		}
+		user.GID = accounts[i].ID
+	}
+
+	return tx.saveAccounts(append(accounts, user))
+}
+
+// SetPassword troca a senha do usuário atual. Uma senha vazia remove a senha,
+// mas só com allowEmpty.
+func (fsys *FileSystem) SetPassword(password string, allowEmpty bool) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+
+	accounts, err := tx.readAccounts()
+	if err != nil {
+		return err
+	}
+
+	i, ok := findAccountID(accounts, AccountUser, fsys.uid)
+	if !ok {
+		return errors.New("usuário não encontrado")
+	}
+
+	err = accounts[i].setPassword(password, allowEmpty)
+	if err != nil {
+		return err
+	}
+
+	return tx.saveAccounts(accounts)
+}
+
+func (tx *transaction) saveAccounts(accounts []Account) error {
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeAccounts(bitmap, accounts)
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeBitmap(bitmap)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
@@ -0,0 +1,299 @@
+package filemanager
+
+import (
+	"fmt"
+	"time"
+)
+
+// SortStats mede uma ordenação. Em merge e radix, que não trocam elementos de
+// lugar, Swaps conta as cópias de elementos. IOBytes soma o que foi lido e
+// gravado no disco, incluindo as runs temporárias.
+type SortStats struct {
+	Algorithm   string
+	Comparisons int64
+	Swaps       int64
+	IOBytes     int64
+	Elapsed     time.Duration
+
+	// SortTime soma o tempo de ordenação em memória de cada run, que é o que
+	// o caminho sequencial gastaria; WallSortTime é o tempo real dessa fase
+	// com Workers goroutines.
+	Workers      int
+	SortTime     time.Duration
+	WallSortTime time.Duration
+
+	// Skipped indica que BenchSort não executou o algoritmo
+	Skipped bool
+}
+
+// EstimatedSpeedup estima a aceleração da ordenação das runs em relação ao
+// caminho sequencial como SortTime / WallSortTime, sem executá-lo. Com mais
+// workers que CPUs, o tempo de cada run inclui a espera da sua goroutine
+// pela CPU, e a estimativa fica acima da aceleração real.
+func (stats *SortStats) EstimatedSpeedup() float64 {
+	if stats.WallSortTime == 0 {
+		return 1
+	}
+	return float64(stats.SortTime) / float64(stats.WallSortTime)
+}
+
+// SortKey escolhe o que é comparado na ordenação: o próprio valor ou uma
+// chave derivada dele.
+type SortKey int
+
+const (
+	KeyValue SortKey = iota
+	KeyAbs
+	KeyModulo
+	KeyDigitSum
+)
+
+// SortOptions configura OrderFile. Os valores zero usam os padrões: memória
+// constants.DefaultSortMemory, DefaultSortAlgorithm, todas as CPUs e ordem
+// crescente pelo valor.
+type SortOptions struct {
+	Memory     int64
+	Algorithm  string
+	Workers    int
+	Descending bool
+	Key        SortKey
+	// Modulus é o divisor de KeyModulo
+	Modulus int32
+	// Stable mantém a ordem original dos valores com chaves iguais. Exige um
+	// dos StableAlgorithms; sem Algorithm, usa merge.
+	Stable bool
+}
+
+// sorter compara valores pela chave escolhida e conta as operações em stats.
+type sorter struct {
+	rank  func(int32) uint32
+	stats *SortStats
+}
+
+func (s *sorter) less(a, b int32) bool {
+	s.stats.Comparisons++
+	return s.rank(a) < s.rank(b)
+}
+
+func (s *sorter) swap(values []int32, i, j int) {
+	s.stats.Swaps++
+	values[i], values[j] = values[j], values[i]
+}
+
+// rankFunc converte cada valor em um uint32 cuja ordem sem sinal é a ordem
+// pedida, o que serve tanto às comparações quanto aos dígitos do radix.
+func rankFunc(opts SortOptions) (func(int32) uint32, error) {
+	var rank func(int32) uint32
+	switch opts.Key {
+	case KeyValue:
+		rank = func(v int32) uint32 { return uint32(v) ^ 1<<31 }
+	case KeyAbs:
+		rank = func(v int32) uint32 { return uint32(absValue(v)) }
+	case KeyModulo:
+		if opts.Modulus <= 0 {
+			return nil, fmt.Errorf("o módulo deve ser positivo: %d", opts.Modulus)
+		}
+		n := int64(opts.Modulus)
+		rank = func(v int32) uint32 { return uint32((int64(v)%n + n) % n) }
+	case KeyDigitSum:
+		rank = func(v int32) uint32 { return digitSum(v) }
+	default:
+		return nil, fmt.Errorf("chave de ordenação %d desconhecida", opts.Key)
+	}
+
+	if opts.Descending {
+		ascending := rank
+		rank = func(v int32) uint32 { return ^ascending(v) }
+	}
+	return rank, nil
+}
+
+func absValue(v int32) int64 {
+	return max(int64(v), -int64(v))
+}
+
+func digitSum(v int32) uint32 {
+	var sum uint32
+	for n := absValue(v); n > 0; n /= 10 {
+		sum += uint32(n % 10)
+	}
+	return sum
+}
+
+// SortAlgorithms lista os algoritmos aceitos por OrderFile, na ordem usada
+// por BenchSort.
+var SortAlgorithms = []string{"quick", "merge", "heap", "radix", "insertion", "shell"}
+
+// StableAlgorithms são os algoritmos que preservam a ordem de chaves iguais.
+var StableAlgorithms = []string{"merge", "radix", "insertion"}
+
+const DefaultSortAlgorithm = "quick"
+
+var sortFuncs = map[string]func(values []int32, s *sorter){
+	"quick":     quickSort,
+	"merge":     mergeSort,
+	"heap":      heapSort,
+	"radix":     radixSort,
+	"insertion": insertionSort,
+	"shell":     shellSort,
+}
+
+func sortFunc(algorithm string) (func([]int32, *sorter), error) {
+	sortValues, ok := sortFuncs[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("algoritmo de ordenação '%s' desconhecido", algorithm)
+	}
+	return sortValues, nil
+}
+
+// quickSort usa a mediana de três como pivô e recorre só na parte menor,
+// limitando a pilha a O(log n).
+func quickSort(values []int32, s *sorter) {
+	for len(values) > 1 {
+		p := partition(values, s) + 1
+		if p < len(values)-p {
+			quickSort(values[:p], s)
+			values = values[p:]
+		} else {
+			quickSort(values[p:], s)
+			values = values[:p]
+		}
+	}
+}
+
+// partition é a partição de Hoare: os valores iguais ao pivô param as duas
+// varreduras e são divididos entre as partes, o que mantém as partes
+// equilibradas com muitos repetidos, e entradas já ordenadas não sofrem
+// trocas. Devolve o último índice da primeira parte.
+func partition(values []int32, s *sorter) int {
+	last := len(values) - 1
+	mid := last / 2
+	if s.less(values[mid], values[0]) {
+		s.swap(values, mid, 0)
+	}
+	if s.less(values[last], values[0]) {
+		s.swap(values, last, 0)
+	}
+	if s.less(values[last], values[mid]) {
+		s.swap(values, last, mid)
+	}
+	pivot := values[mid]
+
+	i, j := -1, len(values)
+	for {
+		for i++; s.less(values[i], pivot); i++ {
+		}
+		for j--; s.less(pivot, values[j]); j-- {
+		}
+		if i >= j {
+			return j
+		}
+		s.swap(values, i, j)
+	}
+}
+
+func mergeSort(values []int32, s *sorter) {
+	buffer := make([]int32, len(values))
+	mergeSortInto(values, buffer, s)
+}
+
+func mergeSortInto(values, buffer []int32, s *sorter) {
+	if len(values) < 2 {
+		return
+	}
+
+	mid := len(values) / 2
+	mergeSortInto(values[:mid], buffer[:mid], s)
+	mergeSortInto(values[mid:], buffer[mid:], s)
+
+	i, j := 0, mid
+	for k := range values {
+		if j == len(values) || (i < mid && !s.less(values[j], values[i])) {
+			buffer[k] = values[i]
+			i++
+		} else {
+			buffer[k] = values[j]
+			j++
+		}
+	}
+	copy(values, buffer)
+	s.stats.Swaps += int64(len(values))
+}
+
+func heapSort(values []int32, s *sorter) {
+	for i := len(values)/2 - 1; i >= 0; i-- {
+		siftDown(values, i, len(values), s)
+	}
+	for end := len(values) - 1; end > 0; end-- {
+		s.swap(values, 0, end)
+		siftDown(values, 0, end, s)
+	}
+}
+
+func siftDown(values []int32, root, end int, s *sorter) {
+	for {
+		child := 2*root + 1
+		if child >= end {
+			return
+		}
+		if child+1 < end && s.less(values[child], values[child+1]) {
+			child++
+		}
+		if !s.less(values[root], values[child]) {
+			return
+		}
+		s.swap(values, root, child)
+		root = child
+	}
+}
+
+// radixSort é um LSD de 4 passadas de 8 bits sobre a chave de cada valor.
+func radixSort(values []int32, s *sorter) {
+	buffer := make([]int32, len(values))
+	src, dst := values, buffer
+
+	for shift := 0; shift < 32; shift += 8 {
+		var counts [257]int
+		for _, value := range src {
+			counts[s.digit(value, shift)+1]++
+		}
+		for d := 1; d < len(counts); d++ {
+			counts[d] += counts[d-1]
+		}
+		for _, value := range src {
+			digit := s.digit(value, shift)
+			dst[counts[digit]] = value
+			counts[digit]++
+		}
+		s.stats.Swaps += int64(len(src))
+		src, dst = dst, src
+	}
+}
+
+func (s *sorter) digit(value int32, shift int) int {
+	return int(s.rank(value) >> shift & 0xff)
+}
+
+func insertionSort(values []int32, s *sorter) {
+	for i := 1; i < len(values); i++ {
+		for j := i; j > 0 && s.less(values[j], values[j-1]); j-- {
+			s.swap(values, j, j-1)
+		}
+	}
+}
+
+// shellSort usa a sequência de Knuth (1, 4, 13, 40, ...).
+func shellSort(values []int32, s *sorter) {
+	gap := 1
+	for gap < len(values)/3 {
+		gap = 3*gap + 1
+	}
+
+	for ; gap > 0; gap /= 3 {
+		for i := gap; i < len(values); i++ {
+			for j := i; j >= gap && s.less(values[j], values[j-gap]); j -= gap {
+				s.swap(values, j, j-gap)
+			}
+		}
+	}
+}
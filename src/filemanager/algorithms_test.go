@@ -0,0 +1,142 @@
+package filemanager
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestSortAlgorithms(t *testing.T) {
+	random := make([]int32, 3000)
+	for i := range random {
+		random[i] = rand.Int31n(2000) - 1000
+	}
+
+	inputs := map[string][]int32{
+		"vazio":       {},
+		"um":          {42},
+		"ordenado":    {1, 2, 3, 4, 5, 6, 7, 8},
+		"invertido":   {8, 7, 6, 5, 4, 3, 2, 1},
+		"repetidos":   slices.Repeat([]int32{5}, 500),
+		"extremos":    {math.MaxInt32, -1, 0, math.MinInt32, 1, math.MinInt32, math.MaxInt32},
+		"aleatório":   random,
+		"dois iguais": {3, 3},
+	}
+
+	rank, err := rankFunc(SortOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algorithm := range SortAlgorithms {
+		for name, input := range inputs {
+			values := slices.Clone(input)
+			var stats SortStats
+			sortFuncs[algorithm](values, &sorter{rank: rank, stats: &stats})
+
+			want := slices.Clone(input)
+			slices.Sort(want)
+			if !slices.Equal(values, want) {
+				t.Errorf("%s em %s: resultado fora de ordem", algorithm, name)
+			}
+			if name == "aleatório" && algorithm != "radix" && stats.Comparisons == 0 {
+				t.Errorf("%s não contou comparações", algorithm)
+			}
+		}
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	values := make([]int32, 2000)
+	for i := range values {
+		values[i] = rand.Int31n(4000) - 2000
+	}
+	values = append(values, math.MinInt32, math.MaxInt32, 0, -7, 7)
+
+	keys := map[string]SortOptions{
+		"valor decrescente": {Descending: true},
+		"absoluto":          {Key: KeyAbs},
+		"módulo":            {Key: KeyModulo, Modulus: 7},
+		"soma dos dígitos":  {Key: KeyDigitSum, Descending: true},
+	}
+
+	for name, opts := range keys {
+		rank, err := rankFunc(opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := slices.Clone(values)
+		slices.SortStableFunc(want, func(a, b int32) int { return cmp.Compare(rank(a), rank(b)) })
+
+		for _, algorithm := range SortAlgorithms {
+			got := slices.Clone(values)
+			sortFuncs[algorithm](got, &sorter{rank: rank, stats: &SortStats{}})
+
+			if slices.Contains(StableAlgorithms, algorithm) {
+				if !slices.Equal(got, want) {
+					t.Errorf("%s com %s: ordem estável não preservada", name, algorithm)
+				}
+				continue
+			}
+			if !slices.IsSortedFunc(got, func(a, b int32) int { return cmp.Compare(rank(a), rank(b)) }) {
+				t.Errorf("%s com %s: resultado fora de ordem", name, algorithm)
+			}
+		}
+	}
+
+	_, err := rankFunc(SortOptions{Key: KeyModulo})
+	if err == nil {
+		t.Fatal("módulo zero deveria falhar")
+	}
+}
+
+func TestOrderFileAlgorithms(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("/dados", 2000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	original, err := fsys.ReadFile("/dados", 0, 2000)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	results, err := fsys.BenchSort("/dados", 4*1024)
+	if err != nil {
+		t.Fatalf("BenchSort: %v", err)
+	}
+	if len(results) != len(SortAlgorithms) {
+		t.Fatalf("BenchSort devolveu %d resultados", len(results))
+	}
+	for _, stats := range results {
+		if stats.Skipped || stats.IOBytes < 2*2000*4 {
+			t.Errorf("%s: estatísticas inesperadas %+v", stats.Algorithm, stats)
+		}
+	}
+
+	after, err := fsys.ReadFile("/dados", 0, 2000)
+	if err != nil || !slices.Equal(after, original) {
+		t.Fatalf("BenchSort alterou o arquivo: %v", err)
+	}
+
+	want := slices.Clone(original)
+	slices.Sort(want)
+	for _, algorithm := range SortAlgorithms {
+		_, err = fsys.OrderFile("/dados", SortOptions{Memory: 4 * 1024, Algorithm: algorithm, Workers: 1})
+		if err != nil {
+			t.Fatalf("OrderFile(%s): %v", algorithm, err)
+		}
+		got, err := fsys.ReadFile("/dados", 0, 2000)
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf("OrderFile(%s) não ordenou: %v", algorithm, err)
+		}
+	}
+
+	_, err = fsys.OrderFile("/dados", SortOptions{Algorithm: "bogo"})
+	if err == nil {
+		t.Fatal("algoritmo desconhecido deveria falhar")
+	}
+}
@@ -0,0 +1,201 @@
+package filemanager
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+type Extent struct {
+	Start int64
+	Count int64
+}
+
+func (fsys *FileSystem) blocksForSize(size int64) int64 {
+	return ceilDiv(size, fsys.sb.BlockSize)
+}
+
+func blockAllocated(bitmap []byte, blockIndex int64) bool {
+	return bitmap[blockIndex/8]&(1<<(blockIndex%8)) != 0
+}
+
+// blockFree informa se o bloco pode ser alocado: livre no bitmap recebido,
+// no que já está no disco (ver FileSystem.flushed), fora das áreas
+// reservadas por ordenações e sem versão pendente em dirty, que o próximo
+// Sync gravaria por cima dos dados do novo dono. As migrações, que não
+// carregam o cache, só consultam o bitmap recebido.
+func (fsys *FileSystem) blockFree(bitmap []byte, blockIndex int64) bool {
+	if blockAllocated(bitmap, blockIndex) {
+		return false
+	}
+	if fsys.flushed == nil {
+		return true
+	}
+	if _, ok := fsys.dirty[blockIndex]; ok {
+		return false
+	}
+	return !blockAllocated(fsys.flushed, blockIndex) && !blockAllocated(fsys.reserved, blockIndex)
+}
+
+func setBlock(bitmap []byte, blockIndex int64, allocated bool) {
+	if allocated {
+		bitmap[blockIndex/8] |= (1 << (blockIndex % 8))
+	} else {
+		bitmap[blockIndex/8] &^= (1 << (blockIndex % 8))
+	}
+}
+
+func markExtents(bitmap []byte, extents []Extent, allocated bool) {
+	for _, extent := range extents {
+		for b := extent.Start; b < extent.Start+extent.Count; b++ {
+			setBlock(bitmap, b, allocated)
+		}
+	}
+}
+
+// freeRuns devolve as sequências de blocos livres da região de dados, em ordem.
+func (fsys *FileSystem) freeRuns(bitmap []byte) []Extent {
+	var runs []Extent
+	for b := fsys.sb.firstDataBlock(); b < fsys.sb.NumBlocks; b++ {
+		if !fsys.blockFree(bitmap, b) {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1].Start+runs[n-1].Count == b {
+			runs[n-1].Count++
+		} else {
+			runs = append(runs, Extent{Start: b, Count: 1})
+		}
+	}
+	return runs
+}
+
+// allocateExtents reserva count blocos no bitmap em memória. Uma única
+// sequência contígua é preferida; caso não exista, as maiores sequências
+// livres são combinadas até o limite de extents de um inode.
+func (fsys *FileSystem) allocateExtents(bitmap []byte, count int64) ([]Extent, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+
+	runs := fsys.freeRuns(bitmap)
+	for _, run := range runs {
+		if run.Count >= count {
+			extents := []Extent{{Start: run.Start, Count: count}}
+			markExtents(bitmap, extents, true)
+			return extents, nil
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Count > runs[j].Count })
+
+	var extents []Extent
+	remaining := count
+	for _, run := range runs {
+		if remaining == 0 {
+			break
+		}
+		if len(extents) == constants.MaxExtents {
+			return nil, errors.New("espaço livre fragmentado demais para o arquivo")
+		}
+		if run.Count > remaining {
+			run.Count = remaining
+		}
+		extents = append(extents, run)
+		remaining -= run.Count
+	}
+
+	if remaining > 0 {
+		return nil, errors.New("espaço insuficiente no disco")
+	}
+
+	sort.Slice(extents, func(i, j int) bool { return extents[i].Start < extents[j].Start })
+	markExtents(bitmap, extents, true)
+	return extents, nil
+}
+
+// dataOffset converte uma posição em bytes dentro do arquivo no deslocamento
+// absoluto correspondente no disco.
+func (inode *Inode) dataOffset(blockSize, pos int64) (int64, error) {
+	offset, _, err := inode.dataSpan(blockSize, pos)
+	return offset, err
+}
+
+// dataSpan é como dataOffset, mas devolve também quantos bytes seguem
+// contíguos no disco a partir dali, até o fim do extent.
+func (inode *Inode) dataSpan(blockSize, pos int64) (int64, int64, error) {
+	for _, extent := range inode.Extents {
+		length := extent.Count * blockSize
+		if pos < length {
+			return extent.Start*blockSize + pos, length - pos, nil
+		}
+		pos -= length
+	}
+	return -1, 0, errors.New("posição fora dos blocos do arquivo")
+}
+
+func totalBlocks(extents []Extent) int64 {
+	var total int64
+	for _, extent := range extents {
+		total += extent.Count
+	}
+	return total
+}
+
+// appendExtents junta more ao final de extents, fundindo sequências contíguas.
+func appendExtents(extents, more []Extent) ([]Extent, error) {
+	for _, extent := range more {
+		if n := len(extents); n > 0 && extents[n-1].Start+extents[n-1].Count == extent.Start {
+			extents[n-1].Count += extent.Count
+			continue
+		}
+		if len(extents) == constants.MaxExtents {
+			return nil, errors.New("número máximo de extents atingido")
+		}
+		extents = append(extents, extent)
+	}
+	return extents, nil
+}
+
+// extendExtents acrescenta count blocos a um arquivo que cresce, usando
+// primeiro os blocos livres logo após o último extent para não fragmentá-lo.
+func (fsys *FileSystem) extendExtents(bitmap []byte, extents []Extent, count int64) ([]Extent, error) {
+	if n := len(extents); n > 0 {
+		next := extents[n-1].Start + extents[n-1].Count
+		free := int64(0)
+		for free < count && next+free < fsys.sb.NumBlocks && fsys.blockFree(bitmap, next+free) {
+			free++
+		}
+		if free > 0 {
+			markExtents(bitmap, []Extent{{Start: next, Count: free}}, true)
+			extents[n-1].Count += free
+			count -= free
+		}
+	}
+
+	more, err := fsys.allocateExtents(bitmap, count)
+	if err != nil {
+		return nil, err
+	}
+	return appendExtents(extents, more)
+}
+
+// truncateExtents mantém os primeiros count blocos de extents e devolve à
+// parte os que sobraram.
+func truncateExtents(extents []Extent, count int64) ([]Extent, []Extent) {
+	var kept, freed []Extent
+	for _, extent := range extents {
+		switch {
+		case count >= extent.Count:
+			kept = append(kept, extent)
+			count -= extent.Count
+		case count > 0:
+			kept = append(kept, Extent{Start: extent.Start, Count: count})
+			freed = append(freed, Extent{Start: extent.Start + count, Count: extent.Count - count})
+			count = 0
+		default:
+			freed = append(freed, extent)
+		}
+	}
+	return kept, freed
+}
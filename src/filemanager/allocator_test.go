@@ -0,0 +1,99 @@
+package filemanager
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+func TestAllocateFragmented(t *testing.T) {
+	dev := device.NewMemoryDevice(512 << 10)
+	err := Format(dev, 1024, 64)
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+
+	// Arquivos de 8 blocos até acabarem os inodes ou o espaço; removidos os
+	// de índice par, sobram buracos de 8 blocos separados pelos que ficaram.
+	var names []string
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("/f%d", i)
+		if fsys.CreateFile(name, 8*256) != nil {
+			break
+		}
+		names = append(names, name)
+	}
+	if len(names) < 2*constants.MaxExtents {
+		t.Fatalf("só %d arquivos couberam no disco", len(names))
+	}
+	for i := 0; i < len(names); i += 2 {
+		err = fsys.RemoveFile(names[i])
+		if err != nil {
+			t.Fatalf("RemoveFile: %v", err)
+		}
+	}
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// 20 blocos não cabem em nenhuma sequência livre e são divididos.
+	for _, run := range fsys.freeRuns(fsys.bitmap) {
+		if run.Count >= 20 {
+			t.Fatalf("sequência livre de %d blocos após fragmentar", run.Count)
+		}
+	}
+	err = fsys.CreateFile("/medio", 20*256)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	inode, err := fsys.Lookup("/medio")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(inode.Extents) < 2 || totalBlocks(inode.Extents) != 20 {
+		t.Fatalf("extents inesperados: %v", inode.Extents)
+	}
+	if !slices.IsSortedFunc(inode.Extents, func(a, b Extent) int { return int(a.Start - b.Start) }) {
+		t.Fatalf("extents fora de ordem: %v", inode.Extents)
+	}
+	want, err := fsys.ReadFile("/medio", 0, 20*256)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	got, err := mustRemount(t, fsys).ReadFile("/medio", 0, 20*256)
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("conteúdo fragmentado não sobreviveu ao remount: %v", err)
+	}
+
+	// Um bloco além das MaxExtents maiores sequências livres não cabe em
+	// um inode, mesmo havendo espaço livre de sobra.
+	runs := fsys.freeRuns(fsys.bitmap)
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Count > runs[j].Count })
+	if len(runs) <= constants.MaxExtents {
+		t.Fatalf("só %d sequências livres", len(runs))
+	}
+	blocks := totalBlocks(runs[:constants.MaxExtents]) + 1
+	before := usedBlocks(fsys)
+
+	err = fsys.CreateFile("/grande", int(blocks*256))
+	if err == nil || !strings.Contains(err.Error(), "fragmentado") {
+		t.Fatalf("CreateFile de %d blocos deveria falhar por fragmentação: %v", blocks, err)
+	}
+	if used := usedBlocks(fsys); used != before {
+		t.Fatalf("a alocação que falhou deixou %d blocos marcados", used-before)
+	}
+}
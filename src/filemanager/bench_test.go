@@ -0,0 +1,97 @@
+package filemanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Jonaires777/src/device"
+)
+
+// benchInts é o tamanho, em inteiros, dos arquivos dos benchmarks.
+const benchInts = 256 * 1024
+
+// newBenchFS usa um arquivo de verdade como disco, para que o custo das
+// chamadas de sistema apareça nas medidas.
+func newBenchFS(b *testing.B) *FileSystem {
+	b.Helper()
+
+	dev, err := device.CreateFileDevice(filepath.Join(b.TempDir(), "disk.img"), 64<<20)
+	if err != nil {
+		b.Fatalf("CreateFileDevice: %v", err)
+	}
+	b.Cleanup(func() { dev.Close() })
+
+	err = Format(dev, 4096, 64)
+	if err != nil {
+		b.Fatalf("Format: %v", err)
+	}
+
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		b.Fatalf("MountDevice: %v", err)
+	}
+	return fsys
+}
+
+func BenchmarkReadFile(b *testing.B) {
+	fsys := newBenchFS(b)
+	err := fsys.CreateFile("dados", benchInts)
+	if err != nil {
+		b.Fatalf("CreateFile: %v", err)
+	}
+
+	b.SetBytes(benchInts * 4)
+	b.ResetTimer()
+	for range b.N {
+		_, err = fsys.ReadFile("dados", 0, benchInts)
+		if err != nil {
+			b.Fatalf("ReadFile: %v", err)
+		}
+	}
+}
+
+func BenchmarkOrderFile(b *testing.B) {
+	fsys := newBenchFS(b)
+	err := fsys.CreateFile("dados", benchInts)
+	if err != nil {
+		b.Fatalf("CreateFile: %v", err)
+	}
+
+	b.SetBytes(benchInts * 4)
+	b.ResetTimer()
+	for range b.N {
+		_, err = fsys.OrderFile("dados", SortOptions{Memory: 256 * 1024, Workers: 1})
+		if err != nil {
+			b.Fatalf("OrderFile: %v", err)
+		}
+	}
+}
+
+func BenchmarkConcatFiles(b *testing.B) {
+	fsys := newBenchFS(b)
+
+	b.SetBytes(benchInts * 4)
+	b.ResetTimer()
+	for range b.N {
+		b.StopTimer()
+		for _, name := range []string{"a", "b"} {
+			err := fsys.CreateFile(name, benchInts/2)
+			if err != nil {
+				b.Fatalf("CreateFile: %v", err)
+			}
+		}
+		b.StartTimer()
+
+		err := fsys.ConcatFiles("a", "b", "c")
+		if err != nil {
+			b.Fatalf("ConcatFiles: %v", err)
+		}
+
+		b.StopTimer()
+		err = fsys.RemoveFile("c")
+		if err != nil {
+			b.Fatalf("RemoveFile: %v", err)
+		}
+		b.StartTimer()
+	}
+}
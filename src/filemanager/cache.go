@@ -0,0 +1,77 @@
+package filemanager
+
+import (
+	"fmt"
+
+	"github.com/Jonaires777/src/device"
+)
+
+// CacheStats conta os acessos ao cache de metadados desde a montagem. A
+// tabela de inodes e o bitmap ficam inteiros em memória, então só as
+// consultas de nomes têm faltas: a primeira em cada diretório lê as suas
+// entradas do disco. Buffers descreve o cache de blocos abaixo dele.
+type CacheStats struct {
+	InodeHits    int64
+	BitmapHits   int64
+	LookupHits   int64
+	LookupMisses int64
+	DirtyBlocks  int
+	Flushes      int64
+	Buffers      device.BufferStats
+}
+
+func (fsys *FileSystem) CacheStats() CacheStats {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	stats := fsys.cacheStats
+	stats.DirtyBlocks = len(fsys.dirty)
+	if fsys.buffers != nil {
+		stats.Buffers = fsys.buffers.Stats()
+	}
+	return stats
+}
+
+// SetBufferCache muda a memória do cache de blocos. Zero desliga o cache, e
+// as leituras e gravações passam a ir direto ao disco.
+func (fsys *FileSystem) SetBufferCache(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("tamanho de cache inválido: %d", size)
+	}
+	if fsys.buffers == nil {
+		return nil
+	}
+	return fsys.buffers.Resize(int(size / fsys.sb.BlockSize))
+}
+
+func (fsys *FileSystem) readBlock(blockIndex int64, p []byte) error {
+	if block, ok := fsys.dirty[blockIndex]; ok {
+		copy(p, block)
+		return nil
+	}
+	return fsys.dev.ReadBlock(blockIndex, p)
+}
+
+// copyDirty copia entre p, que corresponde ao deslocamento off do disco, e os
+// blocos sujos que ele cobre; toDirty indica o sentido da cópia.
+func (fsys *FileSystem) copyDirty(p []byte, off int64, toDirty bool) {
+	if len(fsys.dirty) == 0 {
+		return
+	}
+
+	blockSize := fsys.sb.BlockSize
+	end := off + int64(len(p))
+	for blockIndex := off / blockSize; blockIndex*blockSize < end; blockIndex++ {
+		block, ok := fsys.dirty[blockIndex]
+		if !ok {
+			continue
+		}
+		start := blockIndex * blockSize
+		lo, hi := max(start, off), min(start+blockSize, end)
+		if toDirty {
+			copy(block[lo-start:hi-start], p[lo-off:hi-off])
+		} else {
+			copy(p[lo-off:hi-off], block[lo-start:hi-start])
+		}
+	}
+}
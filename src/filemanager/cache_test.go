@@ -0,0 +1,197 @@
+package filemanager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMetadataCache(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.MakeDirectory("/docs")
+	if err != nil {
+		t.Fatalf("MakeDirectory: %v", err)
+	}
+	err = fsys.CreateFile("/docs/a", 1000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	// A criação invalida o índice de /docs; a primeira consulta o remonta e
+	// a segunda só usa a memória.
+	_, err = fsys.Lookup("/docs/a")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	before := fsys.CacheStats()
+	_, err = fsys.Lookup("/docs/a")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	_, err = fsys.Lookup("/docs/b")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Lookup de nome inexistente: %v", err)
+	}
+	after := fsys.CacheStats()
+	if after.LookupMisses != before.LookupMisses || after.LookupHits != before.LookupHits+4 {
+		t.Fatalf("consultas repetidas deveriam acertar o índice: antes %+v, depois %+v", before, after)
+	}
+
+	// Nada chega ao disco antes do Sync.
+	if after.DirtyBlocks == 0 {
+		t.Fatal("commit deveria deixar blocos sujos")
+	}
+	_, err = mustRemount(t, fsys).Lookup("/docs/a")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("arquivo visível no disco antes do Sync: %v", err)
+	}
+
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if stats := fsys.CacheStats(); stats.DirtyBlocks != 0 || stats.Flushes != 1 {
+		t.Fatalf("estatísticas após Sync: %+v", stats)
+	}
+	_, err = mustRemount(t, fsys).Lookup("/docs/a")
+	if err != nil {
+		t.Fatalf("arquivo ausente do disco após Sync: %v", err)
+	}
+
+	// Os blocos de um arquivo removido continuam dele no disco até o Sync e
+	// não podem ser entregues a outro arquivo antes disso.
+	old, _ := fsys.Lookup("/docs/a")
+	err = fsys.RemoveFile("/docs/a")
+	if err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	err = fsys.CreateFile("/docs/b", 1000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	created, _ := fsys.Lookup("/docs/b")
+	if extentsOverlap(old.Extents, created.Extents) {
+		t.Fatalf("blocos liberados reutilizados antes do Sync: %v e %v", old.Extents, created.Extents)
+	}
+
+	err = fsys.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_, err = mustRemount(t, fsys).Lookup("/docs/b")
+	if err != nil {
+		t.Fatalf("Close deveria gravar os metadados pendentes: %v", err)
+	}
+}
+
+// Um bloco alocado e liberado entre dois Syncs não está ocupado no disco,
+// mas a sua última versão continua em dirty; se fosse reutilizado por dados,
+// o Sync a gravaria por cima deles.
+func TestFreedDirtyBlockNotReused(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.MakeDirectory("/d")
+	if err != nil {
+		t.Fatalf("MakeDirectory: %v", err)
+	}
+	err = fsys.CreateFile("/d/x", 10)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	err = fsys.RemoveFile("/d/x")
+	if err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	err = fsys.RemoveDirectory("/d")
+	if err != nil {
+		t.Fatalf("RemoveDirectory: %v", err)
+	}
+	err = fsys.CreateFile("/y", 2000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	before, err := fsys.ReadFile("/y", 0, 2000)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	after, err := mustRemount(t, fsys).ReadFile("/y", 0, 2000)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for i := range before {
+		if after[i] != before[i] {
+			t.Fatalf("Sync alterou o índice %d de /y: %d virou %d", i, before[i], after[i])
+		}
+	}
+}
+
+func mustRemount(t *testing.T, fsys *FileSystem) *FileSystem {
+	t.Helper()
+
+	remounted, err := MountDevice(fsys.dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+	return remounted
+}
+
+func extentsOverlap(a, b []Extent) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Start < y.Start+y.Count && y.Start < x.Start+x.Count {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestBufferCache(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("/dados", 2000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if stats := fsys.CacheStats().Buffers; stats.Dirty != 0 || stats.Writes == 0 {
+		t.Fatalf("Sync deveria gravar os blocos de dados: %+v", stats)
+	}
+
+	// A segunda leitura do mesmo intervalo vem inteira da memória.
+	_, err = fsys.ReadFile("/dados", 100, 900)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	before := fsys.CacheStats().Buffers
+	_, err = fsys.ReadFile("/dados", 100, 900)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	after := fsys.CacheStats().Buffers
+	if after.Misses != before.Misses || after.Hits <= before.Hits {
+		t.Fatalf("leitura repetida deveria acertar o cache: antes %+v, depois %+v", before, after)
+	}
+
+	// Sem cache, tudo vai direto ao disco.
+	err = fsys.SetBufferCache(0)
+	if err != nil {
+		t.Fatalf("SetBufferCache: %v", err)
+	}
+	_, err = fsys.ReadFile("/dados", 100, 900)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if stats := fsys.CacheStats().Buffers; stats.Blocks != 0 || stats.Hits != after.Hits {
+		t.Fatalf("cache desligado ainda foi usado: %+v", stats)
+	}
+}
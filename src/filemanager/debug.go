@@ -1,33 +1,24 @@
 package filemanager
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
-	"os"
-
-	"github.com/Jonaires777/src/constants"
+	"time"
 )
 
-func PrintBitmap() error {
-	disk, err := os.Open(constants.VirtualDisk)
-	if err != nil {
-		return err
-	}
-	bitmap := make([]byte, constants.BitmapSize)
-	_, err = disk.ReadAt(bitmap, constants.BitmapStart)
+func (fsys *FileSystem) PrintBitmap() error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	bitmap, err := fsys.begin().readBitmap()
 	if err != nil {
 		return err
 	}
 
 	fmt.Println("Blocos ocupados:")
 
-	for i := int64(0); i < constants.BitmapSize; i++ {
-		for j := 0; j < 8; j++ {
-			if (bitmap[i] & (1 << j)) != 0 {
-				blockIndex := i*8 + int64(j)
-				fmt.Printf(" %d", blockIndex)
-			}
+	for blockIndex := int64(0); blockIndex < fsys.sb.NumBlocks; blockIndex++ {
+		if blockAllocated(bitmap, blockIndex) {
+			fmt.Printf(" %d", blockIndex)
 		}
 	}
 
@@ -35,61 +26,51 @@ func PrintBitmap() error {
 	return nil
 }
 
-func PrintSuperblock() error {
-	disk, err := os.Open(constants.VirtualDisk)
-	if err != nil {
-		return err
-	}
-	defer disk.Close()
-
-	data := make([]byte, 40) // Superbloco tem 40 bytes
-	_, err = disk.ReadAt(data, constants.SuperBlockStart)
-	if err != nil {
-		return err
-	}
-
-	superblock := SuperBlock{
-		DiskSize:        int64(binary.LittleEndian.Uint64(data[0:8])),
-		MaxInodes:       int64(binary.LittleEndian.Uint64(data[8:16])),
-		NumBlocks:       int64(binary.LittleEndian.Uint64(data[16:24])),
-		InodeTableStart: int64(binary.LittleEndian.Uint64(data[24:32])),
-		DataStart:       int64(binary.LittleEndian.Uint64(data[32:40])),
-	}
+func (fsys *FileSystem) PrintSuperblock() error {
+	superblock := fsys.sb
 
 	fmt.Println("Superblock:")
+	fmt.Printf("  Layout Version: %d\n", superblock.Version)
+	fmt.Printf("  UUID: %s\n", superblock.UUIDString())
+	fmt.Printf("  Created: %s\n", time.Unix(superblock.CreatedAt, 0).Format(time.RFC3339))
 	fmt.Printf("  Disk Size: %d bytes (%.2f MB)\n", superblock.DiskSize, float64(superblock.DiskSize)/1024/1024)
+	fmt.Printf("  Block Size: %d bytes\n", superblock.BlockSize)
 	fmt.Printf("  Max Inodes: %d\n", superblock.MaxInodes)
+	fmt.Printf("  Inode Size: %d bytes\n", superblock.InodeSize)
 	fmt.Printf("  Number of Blocks: %d\n", superblock.NumBlocks)
+	fmt.Printf("  Bitmap Start: %d\n", superblock.BitmapStart)
 	fmt.Printf("  Inode Table Start: %d\n", superblock.InodeTableStart)
+	fmt.Printf("  Journal Start: %d (%d blocks)\n", superblock.JournalStart, superblock.JournalBlocks)
 	fmt.Printf("  Data Start: %d\n", superblock.DataStart)
+	fmt.Printf("  Accounts Inode: %d\n", superblock.AccountsInode)
 	fmt.Println()
 	return nil
 }
 
-func PrintInodeTable() error {
-	disk, err := os.Open(constants.VirtualDisk)
-	if err != nil {
-		return err
-	}
-	defer disk.Close()
+func (fsys *FileSystem) PrintInodeTable() error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
 
 	fmt.Println("Inode Table:")
-	buffer := make([]byte, constants.InodeSize)
-	for i := int64(0); i < constants.MaxInodes; i++ {
-		offset := constants.InodeTableStart + i*constants.InodeSize
-		_, err := disk.ReadAt(buffer, offset)
+	for i := int64(0); i < fsys.sb.MaxInodes; i++ {
+		inode, err := tx.readInode(i)
 		if err != nil {
 			return err
 		}
 
-		inode := DeserializeInode(buffer)
-		if inode.Size > 0 { // Mostra apenas inodes ocupados
-			filename := string(bytes.Trim(inode.Filename[:], "\x00")) // Remove bytes vazios
-			fmt.Printf("  Inode %d -> File: %s | Size: %d bytes | Start Block: %d\n",
-				i, filename, inode.Size, inode.StartBlock)
+		if inode.Type != TypeFree { // Mostra apenas inodes ocupados
+			kind := "File"
+			if inode.IsDir() {
+				kind = "Dir"
+			} else if inode.Type == TypeAccounts {
+				kind = "Accounts"
+			}
+			fmt.Printf("  Inode %d -> %s: %s | Size: %d | Extents: %v\n",
+				i, kind, inode.Name(), inode.Size, inode.Extents)
 		}
 	}
 	fmt.Println()
 	return nil
 }
-
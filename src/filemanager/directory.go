@@ -0,0 +1,386 @@
+package filemanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+var ErrNotFound = errors.New("arquivo não encontrado")
+
+type DirEntry struct {
+	Name  [32]byte
+	Inode int64
+}
+
+func (entry *DirEntry) name() string {
+	end := bytes.IndexByte(entry.Name[:], 0)
+	if end < 0 {
+		end = len(entry.Name)
+	}
+	return string(entry.Name[:end])
+}
+
+func serializeDirEntry(entry DirEntry) []byte {
+	data := make([]byte, constants.DirEntrySize)
+	copy(data[:32], entry.Name[:])
+	binary.LittleEndian.PutUint64(data[32:40], uint64(entry.Inode))
+	return data
+}
+
+func deserializeDirEntry(data []byte) DirEntry {
+	var entry DirEntry
+	copy(entry.Name[:], data[:32])
+	entry.Inode = int64(binary.LittleEndian.Uint64(data[32:40]))
+	return entry
+}
+
+func (tx *transaction) readDirEntry(dir *Inode, index int64) (DirEntry, error) {
+	offset, err := dir.dataOffset(tx.fsys.sb.BlockSize, index*constants.DirEntrySize)
+	if err != nil {
+		return DirEntry{}, err
+	}
+
+	data := make([]byte, constants.DirEntrySize)
+	_, err = tx.ReadAt(data, offset)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return deserializeDirEntry(data), nil
+}
+
+func (tx *transaction) writeDirEntry(dir *Inode, index int64, entry DirEntry) error {
+	offset, err := dir.dataOffset(tx.fsys.sb.BlockSize, index*constants.DirEntrySize)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.WriteAt(serializeDirEntry(entry), offset)
+	return err
+}
+
+func (tx *transaction) readDirEntries(dir *Inode) ([]DirEntry, error) {
+	entries := make([]DirEntry, 0, dir.Size)
+	for i := int64(0); i < dir.Size; i++ {
+		entry, err := tx.readDirEntry(dir, i)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// nameEntry é a posição de um nome no diretório e o inode a que ele aponta.
+type nameEntry struct {
+	index int64
+	ino   int64
+}
+
+// lookupEntry consulta o índice de nomes de dirIno, montando-o na primeira
+// consulta. Diretórios alterados pela própria transação são lidos direto,
+// porque o índice só reflete o que já foi confirmado.
+func (tx *transaction) lookupEntry(dirIno int64, dir *Inode, name string) (int64, int64, error) {
+	fsys := tx.fsys
+	names, ok := fsys.names[dirIno]
+	if !ok || tx.dirs[dirIno] {
+		fsys.cacheStats.LookupMisses++
+		entries, err := tx.readDirEntries(dir)
+		if err != nil {
+			return -1, -1, err
+		}
+
+		names = make(map[string]nameEntry, len(entries))
+		for i, entry := range entries {
+			names[entry.name()] = nameEntry{index: int64(i), ino: entry.Inode}
+		}
+		if !tx.dirs[dirIno] && fsys.names != nil {
+			fsys.names[dirIno] = names
+		}
+	} else {
+		fsys.cacheStats.LookupHits++
+	}
+
+	entry, ok := names[name]
+	if !ok {
+		return -1, -1, ErrNotFound
+	}
+	return entry.index, entry.ino, nil
+}
+
+// addDirEntry acrescenta name ao diretório dirIno, alocando um novo bloco no
+// bitmap em memória quando os blocos atuais estão cheios.
+func (tx *transaction) addDirEntry(bitmap []byte, dirIno int64, name string, ino int64) error {
+	dir, err := tx.readInode(dirIno)
+	if err != nil {
+		return err
+	}
+
+	capacity := totalBlocks(dir.Extents) * (tx.fsys.sb.BlockSize / constants.DirEntrySize)
+	if dir.Size == capacity {
+		extents, err := tx.fsys.allocateExtents(bitmap, 1)
+		if err != nil {
+			return err
+		}
+
+		dir.Extents, err = appendExtents(dir.Extents, extents)
+		if err != nil {
+			return err
+		}
+	}
+
+	var entry DirEntry
+	copy(entry.Name[:], name)
+	entry.Inode = ino
+
+	err = tx.writeDirEntry(&dir, dir.Size, entry)
+	if err != nil {
+		return err
+	}
+
+	tx.dirs[dirIno] = true
+	dir.Size++
+	dir.Mtime = time.Now().UnixNano()
+	return tx.writeInode(dirIno, dir)
+}
+
+// removeDirEntry apaga name de dirIno movendo a última entrada para a posição
+// liberada, mantendo as entradas contíguas.
+func (tx *transaction) removeDirEntry(dirIno int64, name string) error {
+	dir, err := tx.readInode(dirIno)
+	if err != nil {
+		return err
+	}
+
+	index, _, err := tx.lookupEntry(dirIno, &dir, name)
+	if err != nil {
+		return err
+	}
+
+	last := dir.Size - 1
+	if index != last {
+		entry, err := tx.readDirEntry(&dir, last)
+		if err != nil {
+			return err
+		}
+
+		err = tx.writeDirEntry(&dir, index, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.writeDirEntry(&dir, last, DirEntry{})
+	if err != nil {
+		return err
+	}
+
+	tx.dirs[dirIno] = true
+	dir.Size--
+	dir.Mtime = time.Now().UnixNano()
+	return tx.writeInode(dirIno, dir)
+}
+
+func (tx *transaction) resolvePath(name string) (int64, Inode, error) {
+	ino := int64(constants.RootInode)
+	inode, err := tx.readInode(ino)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	for _, part := range strings.Split(path.Clean("/"+name), "/") {
+		if part == "" {
+			continue
+		}
+
+		if !inode.IsDir() {
+			return -1, Inode{}, errors.New("não é um diretório")
+		}
+
+		err = tx.checkAccess(&inode, permExec)
+		if err != nil {
+			return -1, Inode{}, err
+		}
+
+		_, ino, err = tx.lookupEntry(ino, &inode, part)
+		if err != nil {
+			return -1, Inode{}, err
+		}
+
+		inode, err = tx.readInode(ino)
+		if err != nil {
+			return -1, Inode{}, err
+		}
+	}
+
+	return ino, inode, nil
+}
+
+func (tx *transaction) resolveFile(name string) (int64, Inode, error) {
+	ino, inode, err := tx.resolvePath(name)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+	if inode.IsDir() {
+		return -1, Inode{}, errors.New("é um diretório")
+	}
+	return ino, inode, nil
+}
+
+// splitPath devolve o inode do diretório pai de name e o último componente.
+func (tx *transaction) splitPath(name string) (int64, string, error) {
+	dirname, base := path.Split(path.Clean("/" + name))
+	if base == "" {
+		return -1, "", errors.New("caminho inválido")
+	}
+
+	parentIno, parent, err := tx.resolvePath(dirname)
+	if err != nil {
+		return -1, "", err
+	}
+	if !parent.IsDir() {
+		return -1, "", errors.New("não é um diretório")
+	}
+
+	return parentIno, base, nil
+}
+
+// resolveParent é como splitPath, mas garante que o nome ainda não existe,
+// cabe em uma entrada de diretório e que o usuário pode escrever no pai.
+func (tx *transaction) resolveParent(name string) (int64, string, error) {
+	parentIno, base, err := tx.splitPath(name)
+	if err != nil {
+		return -1, "", err
+	}
+
+	if base == "." || base == ".." {
+		return -1, "", errors.New("caminho inválido")
+	}
+
+	if len(base) >= constants.MaxFilenameLen {
+		return -1, "", errors.New("nome de arquivo muito longo")
+	}
+
+	parent, err := tx.readInode(parentIno)
+	if err != nil {
+		return -1, "", err
+	}
+
+	err = tx.checkAccess(&parent, permWrite|permExec)
+	if err != nil {
+		return -1, "", err
+	}
+
+	_, _, err = tx.lookupEntry(parentIno, &parent, base)
+	if err == nil {
+		return -1, "", errors.New("arquivo já existe")
+	}
+
+	return parentIno, base, nil
+}
+
+func (fsys *FileSystem) Lookup(name string) (Inode, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	_, inode, err := fsys.begin().resolvePath(name)
+	return inode, err
+}
+
+func (fsys *FileSystem) MakeDirectory(dirname string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+
+	parentIno, name, err := tx.resolveParent(dirname)
+	if err != nil {
+		return err
+	}
+
+	ino, err := tx.findFreeInode()
+	if err != nil {
+		return err
+	}
+
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeInode(ino, newInode(name, TypeDir, fsys.uid, fsys.gid))
+	if err != nil {
+		return err
+	}
+
+	err = tx.addDirEntry(bitmap, parentIno, name, ino)
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeBitmap(bitmap)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+func (fsys *FileSystem) RemoveDirectory(dirname string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+
+	ino, dir, err := tx.resolvePath(dirname)
+	if err != nil {
+		return err
+	}
+	if !dir.IsDir() {
+		return errors.New("não é um diretório")
+	}
+	if ino == constants.RootInode {
+		return errors.New("não é possível remover o diretório raiz")
+	}
+	if dir.Size > 0 {
+		return errors.New("diretório não está vazio")
+	}
+
+	parentIno, name, err := tx.splitPath(dirname)
+	if err != nil {
+		return err
+	}
+
+	err = tx.checkDirWrite(parentIno)
+	if err != nil {
+		return err
+	}
+
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return err
+	}
+
+	markExtents(bitmap, dir.Extents, false)
+	err = tx.writeBitmap(bitmap)
+	if err != nil {
+		return err
+	}
+
+	err = tx.removeDirEntry(parentIno, name)
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeInode(ino, Inode{})
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
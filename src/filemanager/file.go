@@ -0,0 +1,426 @@
+package filemanager
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+// File é um arquivo aberto por OpenFile. Read, Write e Seek usam a posição
+// corrente; ReadAt e WriteAt recebem a posição e não a alteram. Arquivos
+// diferentes podem ser usados ao mesmo tempo, mas cada File pertence a uma
+// só goroutine.
+type File struct {
+	fsys   *FileSystem
+	ino    int64
+	ctime  int64
+	name   string
+	flag   int
+	offset int64
+
+	// o tempo de acesso só é gravado no Close, e não a cada leitura
+	accessed bool
+	closed   bool
+}
+
+func (fsys *FileSystem) Open(filename string) (*File, error) {
+	return fsys.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// Create abre filename para leitura e escrita, criando um arquivo vazio ou
+// truncando o que já existe.
+func (fsys *FileSystem) Create(filename string) (*File, error) {
+	return fsys.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, constants.DefaultFileMode)
+}
+
+// OpenFile aceita as mesmas flags de os.OpenFile. perm só é usado quando o
+// arquivo é criado.
+func (fsys *FileSystem) OpenFile(filename string, flag int, perm fs.FileMode) (*File, error) {
+	if fsys.readOnly && (writable(flag) || flag&os.O_CREATE != 0) {
+		return nil, ErrReadOnly
+	}
+
+	ino, inode, err := fsys.openInode(filename, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{fsys: fsys, ino: ino, ctime: inode.Ctime, name: filename, flag: flag}
+	if flag&os.O_TRUNC != 0 && writable(flag) && inode.Size > 0 {
+		err = file.Truncate(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+func (fsys *FileSystem) openInode(filename string, flag int, perm fs.FileMode) (int64, Inode, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+
+	ino, inode, err := tx.resolvePath(filename)
+	switch {
+	case errors.Is(err, ErrNotFound) && flag&os.O_CREATE != 0:
+		ino, inode, err = tx.createEmptyFile(filename, perm)
+		if err != nil {
+			return -1, Inode{}, err
+		}
+
+		err = tx.commit()
+		if err != nil {
+			return -1, Inode{}, err
+		}
+	case err != nil:
+		return -1, Inode{}, err
+	case flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return -1, Inode{}, errors.New("arquivo já existe")
+	case inode.Type != TypeFile:
+		return -1, Inode{}, errors.New("é um diretório")
+	default:
+		var want uint32
+		if readable(flag) {
+			want |= permRead
+		}
+		if writable(flag) {
+			want |= permWrite
+		}
+
+		err = tx.checkAccess(&inode, want)
+		if err != nil {
+			return -1, Inode{}, err
+		}
+	}
+	return ino, inode, nil
+}
+
+func readable(flag int) bool {
+	return flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func writable(flag int) bool {
+	return flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) != os.O_RDONLY
+}
+
+func (tx *transaction) createEmptyFile(filename string, perm fs.FileMode) (int64, Inode, error) {
+	parentIno, name, err := tx.resolveParent(filename)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	ino, err := tx.findFreeInode()
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	inode := newInode(name, TypeFile, tx.fsys.uid, tx.fsys.gid)
+	inode.Mode = uint32(perm & fs.ModePerm)
+	err = tx.writeInode(ino, inode)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	err = tx.addDirEntry(bitmap, parentIno, name, ino)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	err = tx.writeBitmap(bitmap)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	return ino, inode, nil
+}
+
+// inode relê o inode do arquivo, que pode ter mudado desde a abertura. Um
+// Ctime diferente indica que o arquivo foi apagado e o inode reaproveitado.
+func (f *File) inode(tx *transaction) (Inode, error) {
+	if f.closed {
+		return Inode{}, os.ErrClosed
+	}
+
+	inode, err := tx.readInode(f.ino)
+	if err != nil {
+		return Inode{}, err
+	}
+	if inode.Type != TypeFile || inode.Ctime != f.ctime {
+		return Inode{}, errors.New("arquivo foi removido")
+	}
+	return inode, nil
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Stat() (Inode, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	return f.inode(f.fsys.begin())
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		return n, nil
+	}
+	return n, err
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if !readable(f.flag) {
+		return 0, errors.New("arquivo não foi aberto para leitura")
+	}
+	if off < 0 {
+		return 0, errors.New("posição negativa")
+	}
+
+	lock := &f.fsys.inodeLocks[f.ino]
+	lock.RLock()
+	defer lock.RUnlock()
+
+	inode, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if off >= inode.Size {
+		return 0, io.EOF
+	}
+
+	n := int(min(int64(len(p)), inode.Size-off))
+	err = f.fsys.readData(&inode, off, p[:n])
+	if err != nil {
+		return 0, err
+	}
+
+	f.accessed = true
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write grava na posição corrente ou, com O_APPEND, sempre no fim do arquivo.
+func (f *File) Write(p []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		_, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt aumenta o arquivo quando a escrita passa do fim. Os dados vão
+// direto para os blocos; o tamanho e os blocos novos são confirmados por uma
+// transação, como no restante do sistema de arquivos.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if !writable(f.flag) {
+		return 0, errors.New("arquivo não foi aberto para escrita")
+	}
+	if off < 0 {
+		return 0, errors.New("posição negativa")
+	}
+
+	unlock := f.lock()
+	defer unlock()
+
+	tx := f.fsys.begin()
+
+	inode, err := f.inode(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if end := off + int64(len(p)); end > inode.Size {
+		err = tx.growFile(&inode, end, off)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = f.fsys.writeData(&inode, off, p)
+	if err != nil {
+		return 0, err
+	}
+
+	inode.Mtime = time.Now().UnixNano()
+	inode.Flags &^= sortedFlags
+	err = tx.writeInode(f.ino, inode)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.commit()
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		inode, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += inode.Size
+	default:
+		return 0, errors.New("origem de deslocamento inválida")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("posição negativa")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Truncate muda o tamanho do arquivo, liberando os blocos que deixam de ser
+// usados ou preenchendo com zeros o trecho acrescentado.
+func (f *File) Truncate(size int64) error {
+	if !writable(f.flag) {
+		return errors.New("arquivo não foi aberto para escrita")
+	}
+	if size < 0 {
+		return errors.New("tamanho negativo")
+	}
+
+	unlock := f.lock()
+	defer unlock()
+
+	tx := f.fsys.begin()
+
+	inode, err := f.inode(tx)
+	if err != nil {
+		return err
+	}
+
+	if size > inode.Size {
+		err = tx.growFile(&inode, size, size)
+		if err != nil {
+			return err
+		}
+	} else {
+		bitmap, err := tx.readBitmap()
+		if err != nil {
+			return err
+		}
+
+		var freed []Extent
+		inode.Extents, freed = truncateExtents(inode.Extents, f.fsys.blocksForSize(size))
+		markExtents(bitmap, freed, false)
+
+		err = tx.writeBitmap(bitmap)
+		if err != nil {
+			return err
+		}
+		inode.Size = size
+	}
+
+	inode.Mtime = time.Now().UnixNano()
+	inode.Flags &^= sortedFlags
+	err = tx.writeInode(f.ino, inode)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+// Close grava o tempo de acesso quando o arquivo foi lido. Um arquivo apagado
+// enquanto aberto é fechado sem erro.
+func (f *File) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	tx := f.fsys.begin()
+	inode, err := f.inode(tx)
+	f.closed = true
+	if err != nil || !f.accessed || f.fsys.readOnly {
+		return nil
+	}
+
+	inode.Atime = time.Now().UnixNano()
+	err = tx.writeInode(f.ino, inode)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+// lock trava o inode para escrita e depois mu, que ficam travados durante
+// toda a alteração: os blocos novos só entram no bitmap no commit.
+func (f *File) lock() func() {
+	lock := &f.fsys.inodeLocks[f.ino]
+	lock.Lock()
+	f.fsys.mu.Lock()
+	return func() {
+		f.fsys.mu.Unlock()
+		lock.Unlock()
+	}
+}
+
+// growFile aloca blocos para size bytes e zera o trecho entre o fim atual e
+// zeroUntil, já que os blocos podem guardar dados de arquivos apagados.
+func (tx *transaction) growFile(inode *Inode, size, zeroUntil int64) error {
+	fsys := tx.fsys
+
+	if needed, have := fsys.blocksForSize(size), totalBlocks(inode.Extents); needed > have {
+		bitmap, err := tx.readBitmap()
+		if err != nil {
+			return err
+		}
+
+		inode.Extents, err = fsys.extendExtents(bitmap, inode.Extents, needed-have)
+		if err != nil {
+			return err
+		}
+
+		err = tx.writeBitmap(bitmap)
+		if err != nil {
+			return err
+		}
+	}
+
+	zeros := make([]byte, min(max(zeroUntil-inode.Size, 0), fsys.sb.BlockSize))
+	for pos := inode.Size; pos < zeroUntil; pos += int64(len(zeros)) {
+		chunk := zeros[:min(zeroUntil-pos, int64(len(zeros)))]
+		err := fsys.writeData(inode, pos, chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	inode.Size = size
+	return nil
+}
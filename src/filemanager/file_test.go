@@ -0,0 +1,142 @@
+package filemanager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestFileReadWriteSeek(t *testing.T) {
+	fsys := newTestFS(t)
+
+	f, err := fsys.Create("/dados")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	before := usedBlocks(fsys)
+
+	// Escritas em pedaços que não coincidem com os blocos de 1024 bytes.
+	content := bytes.Repeat([]byte("0123456789abcdefg"), 300)
+	for i := 0; i < len(content); i += 700 {
+		_, err = f.Write(content[i:min(i+700, len(content))])
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	inode, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if inode.Size != int64(len(content)) || len(inode.Extents) != 1 {
+		t.Fatalf("inode inesperado: size=%d extents=%v", inode.Size, inode.Extents)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("ReadAll devolveu %d bytes, %v", len(got), err)
+	}
+
+	buf := make([]byte, 10)
+	n, err := f.ReadAt(buf, int64(len(content))-4)
+	if n != 4 || err != io.EOF {
+		t.Fatalf("ReadAt no fim = %d, %v", n, err)
+	}
+
+	// Escrever além do fim deixa um buraco que deve ser lido como zeros.
+	_, err = f.WriteAt([]byte("fim"), int64(len(content))+2000)
+	if err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	hole := make([]byte, 2000)
+	_, err = f.ReadAt(hole, int64(len(content)))
+	if err != nil || !bytes.Equal(hole, make([]byte, 2000)) {
+		t.Fatalf("buraco não foi zerado: %v", err)
+	}
+
+	err = f.Truncate(10)
+	if err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if used := usedBlocks(fsys); used != before+1 {
+		t.Fatalf("blocos em uso após truncar: %d, esperado %d", used, before+1)
+	}
+
+	f, err = fsys.OpenFile("/dados", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	_, err = f.Write([]byte("!"))
+	if err != nil {
+		t.Fatalf("Write com O_APPEND: %v", err)
+	}
+	_, err = f.Read(buf)
+	if err == nil {
+		t.Fatal("leitura de arquivo aberto só para escrita deveria falhar")
+	}
+	f.Close()
+
+	f, err = fsys.Open("/dados")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	got, err = io.ReadAll(f)
+	if err != nil || string(got) != "0123456789!" {
+		t.Fatalf("conteúdo após reabrir = %q, %v", got, err)
+	}
+
+	_, err = f.Write([]byte("x"))
+	if err == nil {
+		t.Fatal("escrita em arquivo aberto só para leitura deveria falhar")
+	}
+}
+
+func TestFileOpenErrors(t *testing.T) {
+	fsys := newTestFS(t)
+
+	_, err := fsys.Open("/nada")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open de arquivo inexistente: %v", err)
+	}
+
+	f, err := fsys.OpenFile("/a", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile com O_EXCL: %v", err)
+	}
+
+	_, err = fsys.OpenFile("/a", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		t.Fatal("O_EXCL em arquivo existente deveria falhar")
+	}
+
+	err = fsys.RemoveFile("/a")
+	if err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	_, err = f.Write([]byte("x"))
+	if err == nil {
+		t.Fatal("escrita em arquivo removido deveria falhar")
+	}
+
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("Seek após Close: %v", err)
+	}
+}
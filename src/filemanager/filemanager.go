@@ -4,66 +4,70 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"io/fs"
 	"math/rand"
 	"os"
-	"sort"
+	"slices"
 	"time"
 
 	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
 )
 
-type Inode struct {
-	Filename   [32]byte
-	Size       int64
-	StartBlock int64
-}
+const (
+	TypeFree uint8 = iota
+	TypeFile
+	TypeDir
+	TypeAccounts
+)
+
+// Flags de arquivo. Indicam a ordem dos inteiros deixada pelo último order
+// por valor; qualquer escrita ou truncamento as apaga.
+const (
+	FlagSortedAsc uint8 = 1 << iota
+	FlagSortedDesc
 
-type SuperBlock struct {
-	DiskSize        int64
-	MaxInodes       int64
-	NumBlocks       int64
-	InodeTableStart int64
-	DataStart       int64
+	sortedFlags = FlagSortedAsc | FlagSortedDesc
+)
+
+// Para arquivos, Size conta bytes; para diretórios, entradas.
+// Os tempos são nanossegundos Unix e Ctime guarda o instante de criação.
+type Inode struct {
+	Filename [32]byte
+	Size     int64
+	Type     uint8
+	Flags    uint8
+	Mode     uint32
+	UID      uint32
+	GID      uint32
+	Ctime    int64
+	Mtime    int64
+	Atime    int64
+	Extents  []Extent
 }
 
-func InitializeBitmap(disk *os.File) error {
-	bitmap := make([]byte, constants.BitmapSize)
+func InitializeBitmap(dev device.BlockDevice, sb SuperBlock) error {
+	bitmap := make([]byte, sb.BitmapSize())
 
-	for i := int64(0); i < (constants.DataStart / constants.BlockSize); i++ {
+	for i := int64(0); i < sb.firstDataBlock(); i++ {
 		byteIndex := i / 8
 		bitOffset := i % 8
 		bitmap[byteIndex] |= (1 << bitOffset)
 	}
 
-	_, err := disk.WriteAt(bitmap, constants.BitmapStart)
-	return err
+	return writeBytes(dev, sb.BlockSize, bitmap, sb.BitmapStart)
 }
 
-func InitializeSuperblock(disk *os.File) error {
-	superblock := SuperBlock{
-		DiskSize:        constants.DiskSize,
-		MaxInodes:       constants.MaxInodes,
-		NumBlocks:       constants.NumBlocks,
-		InodeTableStart: constants.InodeTableStart,
-		DataStart:       constants.DataStart,
-	}
-
-	data := make([]byte, 40)
-	binary.LittleEndian.PutUint64(data[0:8], uint64(superblock.DiskSize))
-	binary.LittleEndian.PutUint64(data[8:16], uint64(superblock.MaxInodes))
-	binary.LittleEndian.PutUint64(data[16:24], uint64(superblock.NumBlocks))
-	binary.LittleEndian.PutUint64(data[24:32], uint64(superblock.InodeTableStart))
-	binary.LittleEndian.PutUint64(data[32:40], uint64(superblock.DataStart))
-
-	_, err := disk.WriteAt(data, constants.SuperBlockStart)
-	return err
+func InitializeSuperblock(dev device.BlockDevice, sb SuperBlock) error {
+	block := make([]byte, sb.BlockSize)
+	copy(block, serializeSuperblock(sb))
+	return dev.WriteBlock(constants.SuperBlockStart, block)
 }
 
-func InitializeInodeTable(disk *os.File) error {
-	emptyInode := make([]byte, constants.InodeSize)
-	for i := int64(0); i < constants.MaxInodes; i++ {
-		offset := constants.InodeTableStart + i*constants.InodeSize
-		_, err := disk.WriteAt(emptyInode, offset)
+func InitializeInodeTable(dev device.BlockDevice, sb SuperBlock) error {
+	emptyBlock := make([]byte, sb.BlockSize)
+	for offset := sb.InodeTableStart; offset < sb.JournalStart; offset += sb.BlockSize {
+		err := dev.WriteBlock(offset/sb.BlockSize, emptyBlock)
 		if err != nil {
 			return err
 		}
@@ -71,74 +75,192 @@ func InitializeInodeTable(disk *os.File) error {
 	return nil
 }
 
-func UpdateBitmap(disk *os.File, blockIndex int64, allocated bool) error {
-	if blockIndex >= constants.NumBlocks {
-		return errors.New("índice do bloco fora do intervalo")
+func InitializeRootDirectory(dev device.BlockDevice, sb SuperBlock) error {
+	root := newInode("/", TypeDir, 0, 0)
+	return writeBytes(dev, sb.BlockSize, SerializeInode(root), sb.inodeOffset(constants.RootInode))
+}
+
+func SerializeInode(inode Inode) []byte {
+	data := make([]byte, constants.InodeSize)
+	copy(data[:32], inode.Filename[:])
+	binary.LittleEndian.PutUint64(data[32:40], uint64(inode.Size))
+	data[40] = inode.Type
+	data[41] = inode.Flags
+	binary.LittleEndian.PutUint32(data[44:48], inode.Mode)
+	binary.LittleEndian.PutUint32(data[48:52], inode.UID)
+	binary.LittleEndian.PutUint32(data[52:56], inode.GID)
+	binary.LittleEndian.PutUint64(data[56:64], uint64(inode.Ctime))
+	binary.LittleEndian.PutUint64(data[64:72], uint64(inode.Mtime))
+	binary.LittleEndian.PutUint64(data[72:80], uint64(inode.Atime))
+	for i, extent := range inode.Extents {
+		offset := constants.ExtentsStart + i*8
+		binary.LittleEndian.PutUint32(data[offset:offset+4], uint32(extent.Start))
+		binary.LittleEndian.PutUint32(data[offset+4:offset+8], uint32(extent.Count))
 	}
+	return data
+}
 
-	byteIndex := blockIndex / 8
-	bitOffset := blockIndex % 8
+func (inode *Inode) Name() string {
+	end := bytes.IndexByte(inode.Filename[:], 0)
+	if end < 0 {
+		end = len(inode.Filename)
+	}
+	return string(inode.Filename[:end])
+}
 
-	var singleByte [1]byte
-	_, err := disk.ReadAt(singleByte[:], constants.BitmapStart+byteIndex)
-	if err != nil {
-		return err
+// Sorted informa se os inteiros do arquivo estão ordenados por valor.
+func (inode *Inode) Sorted() bool {
+	return inode.Flags&sortedFlags != 0
+}
+
+func (inode *Inode) IsDir() bool {
+	return inode.Type == TypeDir
+}
+
+// FileMode combina o tipo e os bits de permissão no formato de io/fs.
+func (inode *Inode) FileMode() fs.FileMode {
+	mode := fs.FileMode(inode.Mode) & fs.ModePerm
+	if inode.IsDir() {
+		mode |= fs.ModeDir
 	}
+	return mode
+}
 
-	if allocated {
-		singleByte[0] |= (1 << bitOffset)
-	} else {
-		singleByte[0] &^= (1 << bitOffset)
+func newInode(name string, inodeType uint8, uid, gid uint32) Inode {
+	inode := Inode{Type: inodeType, UID: uid, GID: gid, Mode: constants.DefaultFileMode}
+	if inodeType == TypeDir {
+		inode.Mode = constants.DefaultDirMode
 	}
+	copy(inode.Filename[:], name)
+	inode.Ctime = time.Now().UnixNano()
+	inode.Mtime = inode.Ctime
+	inode.Atime = inode.Ctime
+	return inode
+}
 
-	_, err = disk.WriteAt(singleByte[:], constants.BitmapStart+byteIndex)
+func (tx *transaction) readInode(ino int64) (Inode, error) {
+	if ino < 0 || ino >= tx.fsys.sb.MaxInodes {
+		return Inode{}, errors.New("número de inode inválido")
+	}
+
+	offset := tx.fsys.sb.inodeOffset(ino)
+	if block, ok := tx.blocks[offset/tx.fsys.sb.BlockSize]; ok {
+		inBlock := offset % tx.fsys.sb.BlockSize
+		return DeserializeInode(block[inBlock : inBlock+constants.InodeSize]), nil
+	}
+	return tx.fsys.cachedInode(ino), nil
+}
+
+func (tx *transaction) writeInode(ino int64, inode Inode) error {
+	_, err := tx.WriteAt(SerializeInode(inode), tx.fsys.sb.inodeOffset(ino))
 	return err
 }
 
-func SerializeInode(inode Inode) []byte {
-	data := make([]byte, constants.InodeSize)
-	copy(data[:32], inode.Filename[:])
-	binary.LittleEndian.PutUint64(data[32:40], uint64(inode.Size))
-	binary.LittleEndian.PutUint64(data[40:48], uint64(inode.StartBlock))
-	return data
+// readBitmap devolve uma cópia do bitmap em cache com as alterações ainda não
+// confirmadas desta transação.
+func (tx *transaction) readBitmap() ([]byte, error) {
+	sb := &tx.fsys.sb
+	tx.fsys.cacheStats.BitmapHits++
+	bitmap := slices.Clone(tx.fsys.bitmap)
+
+	for blockIndex, block := range tx.blocks {
+		start := blockIndex * sb.BlockSize
+		if start+sb.BlockSize <= sb.BitmapStart || start >= sb.BitmapStart+sb.BitmapSize() {
+			continue
+		}
+		copy(bitmap[start-sb.BitmapStart:], block)
+	}
+	return bitmap, nil
+}
+
+func (tx *transaction) writeBitmap(bitmap []byte) error {
+	_, err := tx.WriteAt(bitmap, tx.fsys.sb.BitmapStart)
+	return err
 }
 
 func DeserializeInode(data []byte) Inode {
 	var inode Inode
 	copy(inode.Filename[:], data[:32])
 	inode.Size = int64(binary.LittleEndian.Uint64(data[32:40]))
-	inode.StartBlock = int64(binary.LittleEndian.Uint64(data[40:48]))
+	inode.Type = data[40]
+	inode.Flags = data[41]
+	inode.Mode = binary.LittleEndian.Uint32(data[44:48])
+	inode.UID = binary.LittleEndian.Uint32(data[48:52])
+	inode.GID = binary.LittleEndian.Uint32(data[52:56])
+	inode.Ctime = int64(binary.LittleEndian.Uint64(data[56:64]))
+	inode.Mtime = int64(binary.LittleEndian.Uint64(data[64:72]))
+	inode.Atime = int64(binary.LittleEndian.Uint64(data[72:80]))
+	for i := 0; i < constants.MaxExtents; i++ {
+		offset := constants.ExtentsStart + i*8
+		count := int64(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		if count == 0 {
+			break
+		}
+		start := int64(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		inode.Extents = append(inode.Extents, Extent{Start: start, Count: count})
+	}
 	return inode
 }
 
 func CreateVirtualDisk(filename string) error {
-	file, err := os.Create(filename)
+	return FormatVirtualDisk(filename, constants.DefaultDiskSize, constants.DefaultBlockSize, constants.DefaultMaxInodes)
+}
+
+func FormatVirtualDisk(filename string, diskSize, blockSize, maxInodes int64) error {
+	// Uma geometria inválida não pode apagar o disco que já existe.
+	_, err := NewSuperBlock(diskSize, blockSize, maxInodes)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	err = file.Truncate(constants.DiskSize)
+	dev, err := device.CreateFileDevice(filename, diskSize)
 	if err != nil {
 		return err
 	}
+	defer dev.Close()
 
-	err = InitializeSuperblock(file)
+	err = Format(dev, blockSize, maxInodes)
 	if err != nil {
 		return err
 	}
 
-	err = InitializeBitmap(file)
+	return dev.Sync()
+}
+
+// Format grava um sistema de arquivos vazio ocupando todo o dispositivo.
+func Format(dev device.BlockDevice, blockSize, maxInodes int64) error {
+	sb, err := NewSuperBlock(dev.Size(), blockSize, maxInodes)
 	if err != nil {
 		return err
 	}
+	sb.AccountsInode = constants.RootInode + 1
 
-	err = InitializeInodeTable(file)
+	err = InitializeSuperblock(dev, sb)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = InitializeBitmap(dev, sb)
+	if err != nil {
+		return err
+	}
+
+	err = InitializeInodeTable(dev, sb)
+	if err != nil {
+		return err
+	}
+
+	err = InitializeJournal(dev, sb)
+	if err != nil {
+		return err
+	}
+
+	err = InitializeRootDirectory(dev, sb)
+	if err != nil {
+		return err
+	}
+
+	return InitializeAccounts(dev)
 }
 
 func CheckFileExistence(filename string) bool {
@@ -146,83 +268,107 @@ func CheckFileExistence(filename string) bool {
 	return !os.IsNotExist(err)
 }
 
-func CreateFile(filename string, size int) error {
-	disk, err := os.OpenFile(constants.VirtualDisk, os.O_RDWR, 0666)
+func (fsys *FileSystem) CreateFile(filename string, size int) error {
+	if fsys.readOnly {
+		return ErrReadOnly
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if size <= 0 {
+		return errors.New("tamanho do arquivo deve ser maior que zero")
+	}
+
+	tx := fsys.begin()
+
+	parentIno, name, err := tx.resolveParent(filename)
 	if err != nil {
 		return err
 	}
-	defer disk.Close()
 
-	inodes, _, _ := ListFiles()
-	for _, inode := range inodes {
-		if string(inode.Filename[:bytes.IndexByte(inode.Filename[:], 0)]) == filename {
-			return errors.New("arquivo já existe")
-		}
+	ino, err := tx.findFreeInode()
+	if err != nil {
+		return err
 	}
 
-	inodeOffset, err := findFreeInode(disk)
+	bitmap, err := tx.readBitmap()
 	if err != nil {
 		return err
 	}
 
-	startBlock, err := findFreeBlock(disk)
+	extents, err := fsys.allocateExtents(bitmap, fsys.blocksForSize(int64(size)*4))
 	if err != nil {
 		return err
 	}
 
-	if int64(size)*4 > constants.DiskSize-(startBlock-constants.DataStart) {
-		return errors.New("espaço insuficiente no disco")
+	inode := newInode(name, TypeFile, fsys.uid, fsys.gid)
+	inode.Size = int64(size) * 4
+	inode.Extents = extents
+
+	data := make([]byte, size*4)
+	for i := 0; i < size; i++ {
+		binary.LittleEndian.PutUint32(data[i*4:], uint32(rand.Intn(100000)))
 	}
 
-	err = UpdateBitmap(disk, (startBlock-constants.DataStart)/constants.BlockSize, true)
+	err = fsys.writeData(&inode, 0, data)
 	if err != nil {
 		return err
 	}
 
-	var inode Inode
-	copy(inode.Filename[:], []byte(filename))
-	inode.Size = int64(size)
-	inode.StartBlock = startBlock
-
-	_, err = disk.WriteAt(SerializeInode(inode), inodeOffset)
+	err = tx.writeInode(ino, inode)
 	if err != nil {
 		return err
 	}
 
-	data := make([]byte, size*4)
-	for i := 0; i < size; i++ {
-		binary.LittleEndian.PutUint32(data[i*4:], uint32(rand.Intn(100000)))
+	err = tx.addDirEntry(bitmap, parentIno, name, ino)
+	if err != nil {
+		return err
 	}
 
-	_, err = disk.WriteAt(data, startBlock)
+	err = tx.writeBitmap(bitmap)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.commit()
 }
 
-func ListFiles() ([]Inode, int64, error) {
+func (fsys *FileSystem) ListFiles(dirname string) ([]Inode, int64, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
 	var inodes []Inode
 	var totalUsed int64
 
-	disk, err := os.Open(constants.VirtualDisk)
+	tx := fsys.begin()
+
+	_, dir, err := tx.resolvePath(dirname)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !dir.IsDir() {
+		return nil, 0, errors.New("não é um diretório")
+	}
+
+	err = tx.checkAccess(&dir, permRead)
 	if err != nil {
 		return nil, 0, err
 	}
-	defer disk.Close()
 
-	buffer := make([]byte, constants.InodeSize)
-	for i := int64(0); i < constants.MaxInodes; i++ {
-		offset := constants.InodeTableStart + i*constants.InodeSize
-		_, err := disk.ReadAt(buffer, offset)
+	entries, err := tx.readDirEntries(&dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, entry := range entries {
+		inode, err := tx.readInode(entry.Inode)
 		if err != nil {
-			break
+			return nil, 0, err
 		}
 
-		inode := DeserializeInode(buffer)
-		if inode.Size > 0 {
-			inodes = append(inodes, inode)
+		inodes = append(inodes, inode)
+		if !inode.IsDir() {
 			totalUsed += inode.Size
 		}
 	}
@@ -230,287 +376,317 @@ func ListFiles() ([]Inode, int64, error) {
 	return inodes, totalUsed, nil
 }
 
-func RemoveFile(filename string) error {
-	disk, err := os.OpenFile(constants.VirtualDisk, os.O_RDWR, 0666)
+func (fsys *FileSystem) RemoveFile(filename string) error {
+	unlock, err := fsys.lockFiles(true, filename)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	defer disk.Close()
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
 
-	buffer := make([]byte, constants.InodeSize)
-	for i := int64(0); i < constants.MaxInodes; i++ {
-		offset := constants.InodeTableStart + i*constants.InodeSize
-		_, err := disk.ReadAt(buffer, offset)
-		if err != nil {
-			break
-		}
+	tx := fsys.begin()
 
-		inode := DeserializeInode(buffer)
-		if inode.Size > 0 {
-			if string(inode.Filename[:bytes.IndexByte(inode.Filename[:], 0)]) == filename {
-				err = UpdateBitmap(disk, (inode.StartBlock-constants.DataStart)/constants.BlockSize, false)
-				if err != nil {
-					return err
-				}
-
-				emptyInode := Inode{}
-				_, err = disk.WriteAt(SerializeInode(emptyInode), constants.InodeTableStart+i*constants.InodeSize)
-				if err != nil {
-					return err
-				}
-
-				return nil
-			}
-		}
+	parentIno, name, err := tx.splitPath(filename)
+	if err != nil {
+		return err
 	}
 
-	return errors.New("arquivo não encontrado")
-}
+	err = tx.checkDirWrite(parentIno)
+	if err != nil {
+		return err
+	}
 
-func ReadFile(filename string, startIdx, endIdx int64) ([]int32, error) {
-	disk, err := os.Open(constants.VirtualDisk)
+	ino, inode, err := tx.resolvePath(filename)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if inode.IsDir() {
+		return errors.New("é um diretório, use rmdir")
+	}
+
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return err
+	}
+
+	markExtents(bitmap, inode.Extents, false)
+	err = tx.writeBitmap(bitmap)
+	if err != nil {
+		return err
+	}
+
+	err = tx.removeDirEntry(parentIno, name)
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeInode(ino, Inode{})
+	if err != nil {
+		return err
 	}
-	defer disk.Close()
 
+	return tx.commit()
+}
+
+func (fsys *FileSystem) ReadFile(filename string, startIdx, endIdx int64) ([]int32, error) {
 	if startIdx < 0 || endIdx < 0 || startIdx > endIdx {
 		return nil, errors.New("índices inválidos")
 	}
 
-	inodes, _, _ := ListFiles()
-	for _, inode := range inodes {
-		if string(inode.Filename[:bytes.IndexByte(inode.Filename[:], 0)]) == filename {
-
-			if int64(endIdx) > inode.Size {
-				return nil, errors.New("índice final maior que o tamanho do arquivo")
-			}
-
-			var numbers []int32
-			for i := startIdx; i < endIdx; i++ {
-				offset := inode.StartBlock + i*4
-				data := make([]byte, 4)
-				_, err := disk.ReadAt(data, offset)
-				if err != nil {
-					return nil, err
-				}
-				numbers = append(numbers, int32(binary.LittleEndian.Uint32(data)))
-			}
-			return numbers, nil
-		}
+	unlock, err := fsys.lockFiles(false, filename)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("arquivo não encontrado")
-}
+	defer unlock()
 
-func OrderFile(filename string) (int64, error) {
-	disk, err := os.OpenFile(constants.VirtualDisk, os.O_RDWR, 0666)
+	ino, inode, err := fsys.openFile(filename, permRead)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer disk.Close()
 
-	buffer := make([]byte, constants.InodeSize)
-	for i := int64(0); i < constants.MaxInodes; i++ {
-		offset := constants.InodeTableStart + i*constants.InodeSize
-		_, err := disk.ReadAt(buffer, offset)
-		if err != nil {
-			break
-		}
+	if endIdx > inode.Size/4 {
+		return nil, errors.New("índice final maior que o tamanho do arquivo")
+	}
 
-		inode := DeserializeInode(buffer)
-		if inode.Size > 0 {
-			if string(inode.Filename[:bytes.IndexByte(inode.Filename[:], 0)]) == filename {
-				var numbers []int32
-				for i := int64(0); i < inode.Size; i++ {
-					offset := inode.StartBlock + i*4
-					data := make([]byte, 4)
-					_, err := disk.ReadAt(data, offset)
-					if err != nil {
-						return 0, err
-					}
-					numbers = append(numbers, int32(binary.LittleEndian.Uint32(data)))
-				}
-
-				intNumbers := make([]int, len(numbers))
-				for i, num := range numbers {
-					intNumbers[i] = int(num)
-				}
-
-				startTime := time.Now()
-
-				sort.Ints(intNumbers)
-
-				for i, num := range intNumbers {
-					numbers[i] = int32(num)
-				}
-
-				for i, num := range numbers {
-					offset := inode.StartBlock + int64(i)*4
-					data := make([]byte, 4)
-					binary.LittleEndian.PutUint32(data, uint32(num))
-					_, err := disk.WriteAt(data, offset)
-					if err != nil {
-						return 0, err
-					}
-				}
-
-				elapsedTime := time.Now().Sub(startTime).Milliseconds()
-
-				return elapsedTime, nil
-			}
+	numbers := make([]int32, 0, endIdx-startIdx)
+	buffer := fsys.ioBuffer()
+	for pos := startIdx * 4; pos < endIdx*4; pos += int64(len(buffer)) {
+		chunk := buffer[:min(int64(len(buffer)), endIdx*4-pos)]
+		err = fsys.readData(&inode, pos, chunk)
+		if err != nil {
+			return nil, err
 		}
+		numbers = decodeInts(numbers, chunk)
 	}
 
-	return 0, errors.New("arquivo não encontrado")
+	return numbers, fsys.touch(ino)
 }
 
-func ConcatFiles(filename1, filename2, newFilename string) error {
-	disk, err := os.OpenFile(constants.VirtualDisk, os.O_RDWR, 0666)
+// ConcatFiles trava as duas origens para escrita, já que elas são apagadas.
+// A cópia é feita com mu travado, pois os blocos do novo arquivo ainda não
+// estão no bitmap.
+func (fsys *FileSystem) ConcatFiles(filename1, filename2, newFilename string) error {
+	if fsys.readOnly {
+		return ErrReadOnly
+	}
+
+	unlock, err := fsys.lockFiles(true, filename1, filename2)
 	if err != nil {
 		return err
 	}
-	defer disk.Close()
+	defer unlock()
 
-	buffer := make([]byte, constants.InodeSize)
-	var inode1, inode2 Inode
-	for i := int64(0); i < constants.MaxInodes; i++ {
-		offset := constants.InodeTableStart + i*constants.InodeSize
-		_, err := disk.ReadAt(buffer, offset)
-		if err != nil {
-			break
-		}
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
 
-		inode := DeserializeInode(buffer)
-		if inode.Size > 0 {
-			if string(inode.Filename[:bytes.IndexByte(inode.Filename[:], 0)]) == filename1 {
-				inode1 = inode
-				err = UpdateBitmap(disk, (inode1.StartBlock-constants.DataStart)/constants.BlockSize, false)
-
-				if err != nil {
-					return err
-				}
-
-				err = RemoveFile(filename1)
-				if err != nil {
-					return err
-				}
-
-			} else if string(inode.Filename[:bytes.IndexByte(inode.Filename[:], 0)]) == filename2 {
-				inode2 = inode
-
-				err = UpdateBitmap(disk, (inode2.StartBlock-constants.DataStart)/constants.BlockSize, false)
-				if err != nil {
-					return err
-				}
-
-				err = RemoveFile(filename2)
-				if err != nil {
-					return err
-				}
-			}
-		}
+	tx := fsys.begin()
+
+	ino1, inode1, err := tx.resolveFile(filename1)
+	if err != nil {
+		return err
+	}
+
+	ino2, inode2, err := tx.resolveFile(filename2)
+	if err != nil {
+		return err
+	}
+
+	if ino1 == ino2 {
+		return errors.New("os arquivos de origem devem ser diferentes")
+	}
+
+	parent1, name1, err := tx.splitPath(filename1)
+	if err != nil {
+		return err
+	}
+
+	parent2, name2, err := tx.splitPath(filename2)
+	if err != nil {
+		return err
+	}
+
+	// As origens são lidas e depois apagadas dos seus diretórios.
+	err = tx.checkAccess(&inode1, permRead)
+	if err != nil {
+		return err
+	}
+
+	err = tx.checkAccess(&inode2, permRead)
+	if err != nil {
+		return err
+	}
+
+	err = tx.checkDirWrite(parent1)
+	if err != nil {
+		return err
+	}
+
+	err = tx.checkDirWrite(parent2)
+	if err != nil {
+		return err
 	}
 
-	if inode1.Size == 0 || inode2.Size == 0 {
-		return errors.New("arquivo não encontrado")
+	newParent, newName, err := tx.resolveParent(newFilename)
+	if err != nil {
+		return err
+	}
+
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return err
+	}
+
+	// Os blocos de origem só são liberados depois da alocação: o novo conteúdo
+	// é gravado antes do commit e não pode sobrescrever dados ainda válidos.
+	concat := newInode(newName, TypeFile, fsys.uid, fsys.gid)
+	concat.Size = inode1.Size + inode2.Size
+	concat.Extents, err = fsys.allocateExtents(bitmap, fsys.blocksForSize(concat.Size))
+	if err != nil {
+		return err
 	}
 
-	newSize := inode1.Size + inode2.Size
-	if newSize*4 > constants.DiskSize-(inode1.StartBlock-constants.DataStart) {
-		return errors.New("espaço insuficiente no disco")
+	markExtents(bitmap, inode1.Extents, false)
+	markExtents(bitmap, inode2.Extents, false)
+
+	buffer := fsys.ioBuffer()
+	err = fsys.copyData(&concat, 0, &inode1, buffer)
+	if err != nil {
+		return err
 	}
 
-	newInodeOffset, err := findFreeInode(disk)
+	err = fsys.copyData(&concat, inode1.Size, &inode2, buffer)
 	if err != nil {
 		return err
 	}
 
-	newStartBlock, err := findFreeBlock(disk)
+	err = tx.removeDirEntry(parent1, name1)
 	if err != nil {
 		return err
 	}
 
-	err = UpdateBitmap(disk, (newStartBlock-constants.DataStart)/constants.BlockSize, true)
+	err = tx.removeDirEntry(parent2, name2)
 	if err != nil {
 		return err
 	}
 
-	var newInode Inode
-	copy(newInode.Filename[:], []byte(newFilename))
-	newInode.Size = newSize
-	newInode.StartBlock = newStartBlock
+	err = tx.writeInode(ino2, Inode{})
+	if err != nil {
+		return err
+	}
 
-	_, err = disk.WriteAt(SerializeInode(newInode), newInodeOffset)
+	err = tx.writeInode(ino1, concat)
 	if err != nil {
 		return err
 	}
 
-	data1 := make([]byte, inode1.Size*4)
-	for i := int64(0); i < inode1.Size; i++ {
-		offset := inode1.StartBlock + i*4
-		data := make([]byte, 4)
-		_, err := disk.ReadAt(data, offset)
+	err = tx.addDirEntry(bitmap, newParent, newName, ino1)
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeBitmap(bitmap)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+// ioBuffer devolve um buffer de cerca de constants.IOBufferSize bytes, com um
+// número inteiro de blocos, para ser reaproveitado ao longo de uma operação.
+func (fsys *FileSystem) ioBuffer() []byte {
+	blocks := max(constants.IOBufferSize/fsys.sb.BlockSize, 1)
+	return make([]byte, blocks*fsys.sb.BlockSize)
+}
+
+// copyData copia todo o conteúdo de src para dst a partir da posição pos,
+// em pedaços do tamanho de buffer.
+func (fsys *FileSystem) copyData(dst *Inode, pos int64, src *Inode, buffer []byte) error {
+	for n := int64(0); n < src.Size; n += int64(len(buffer)) {
+		chunk := buffer[:min(int64(len(buffer)), src.Size-n)]
+		err := fsys.readData(src, n, chunk)
 		if err != nil {
 			return err
 		}
-		copy(data1[i*4:], data)
-	}
-
-	data2 := make([]byte, inode2.Size*4)
-	for i := int64(0); i < inode2.Size; i++ {
-		offset := inode2.StartBlock + i*4
-		data := make([]byte, 4)
-		_, err := disk.ReadAt(data, offset)
+		err = fsys.writeData(dst, pos+n, chunk)
 		if err != nil {
 			return err
 		}
-		copy(data2[i*4:], data)
 	}
+	return nil
+}
 
-	newData := append(data1, data2...)
-	_, err = disk.WriteAt(newData, newStartBlock)
-	if err != nil {
-		return err
+// decodeInts acrescenta a values os inteiros little-endian de data.
+func decodeInts(values []int32, data []byte) []int32 {
+	for i := 0; i+4 <= len(data); i += 4 {
+		values = append(values, int32(binary.LittleEndian.Uint32(data[i:])))
 	}
+	return values
+}
 
-	return nil
+// encodeInts acrescenta a data os valores em little-endian.
+func encodeInts(data []byte, values []int32) []byte {
+	for _, value := range values {
+		data = binary.LittleEndian.AppendUint32(data, uint32(value))
+	}
+	return data
 }
 
-func findFreeInode(disk *os.File) (int64, error) {
-	buffer := make([]byte, constants.InodeSize)
-	for i := int64(0); i < constants.MaxInodes; i++ {
-		offset := constants.InodeTableStart + i*constants.InodeSize
-		_, err := disk.ReadAt(buffer, offset)
+// readData lê len(data) bytes a partir da posição pos do arquivo, com uma
+// leitura por extent. Blocos de arquivos nunca estão entre os blocos sujos de
+// metadados, então a leitura vai direto ao dispositivo e não precisa de mu.
+func (fsys *FileSystem) readData(inode *Inode, pos int64, data []byte) error {
+	for len(data) > 0 {
+		offset, n, err := inode.dataSpan(fsys.sb.BlockSize, pos)
 		if err != nil {
-			return -1, err
+			return err
 		}
+		n = min(n, int64(len(data)))
 
-		inode := DeserializeInode(buffer)
-		if inode.Size == 0 {
-			return offset, nil
+		err = readBytes(fsys.dev, fsys.sb.BlockSize, data[:n], offset)
+		if err != nil {
+			return err
 		}
+
+		data = data[n:]
+		pos += n
 	}
-	return -1, errors.New("sem espaço para novos arquivos")
+	return nil
 }
 
-func findFreeBlock(disk *os.File) (int64, error) {
-	bitmap := make([]byte, constants.BitmapSize)
-	_, err := disk.ReadAt(bitmap, constants.BitmapStart)
-	if err != nil {
-		return -1, err
+// writeData grava data a partir da posição pos do arquivo, com uma escrita
+// por extent. Como readData, não passa pelos blocos sujos.
+func (fsys *FileSystem) writeData(inode *Inode, pos int64, data []byte) error {
+	for len(data) > 0 {
+		offset, n, err := inode.dataSpan(fsys.sb.BlockSize, pos)
+		if err != nil {
+			return err
+		}
+		n = min(n, int64(len(data)))
+
+		err = writeBytes(fsys.dev, fsys.sb.BlockSize, data[:n], offset)
+		if err != nil {
+			return err
+		}
+
+		data = data[n:]
+		pos += n
 	}
+	return nil
+}
 
-	for i := int64(0); i < constants.BitmapSize; i++ {
-		for j := 0; j < 8; j++ {
-			if (bitmap[i] & (1 << j)) == 0 {
-				blockIndex := i*8 + int64(j)
-				if blockIndex >= constants.NumBlocks {
-					return -1, errors.New("sem blocos disponíveis")
-				}
-				return constants.DataStart + blockIndex*constants.BlockSize, nil
-			}
+func (tx *transaction) findFreeInode() (int64, error) {
+	for i := int64(0); i < tx.fsys.sb.MaxInodes; i++ {
+		inode, err := tx.readInode(i)
+		if err != nil {
+			return -1, err
+		}
+
+		if inode.Type == TypeFree {
+			return i, nil
 		}
 	}
-	return -1, errors.New("sem blocos disponíveis")
+	return -1, errors.New("sem espaço para novos arquivos")
 }
@@ -0,0 +1,427 @@
+package filemanager
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+func newTestFS(t *testing.T) *FileSystem {
+	t.Helper()
+
+	dev := device.NewMemoryDevice(4 << 20)
+	err := Format(dev, 1024, 64)
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+	return fsys
+}
+
+func usedBlocks(fsys *FileSystem) int {
+	used := 0
+	for b := int64(0); b < fsys.sb.NumBlocks; b++ {
+		if blockAllocated(fsys.bitmap, b) {
+			used++
+		}
+	}
+	return used
+}
+
+func TestCreateReadRemove(t *testing.T) {
+	fsys := newTestFS(t)
+
+	// Maior que um bloco, para atravessar vários blocos de dados.
+	err := fsys.CreateFile("a", 1000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	inode, err := fsys.Lookup("a")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if inode.Size != 4000 || totalBlocks(inode.Extents) != 4 {
+		t.Fatalf("inode inesperado: size=%d extents=%v", inode.Size, inode.Extents)
+	}
+	// O bloco de entradas da raiz continua alocado depois da remoção.
+	before := usedBlocks(fsys) - 4
+
+	numbers, err := fsys.ReadFile("a", 250, 260)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if len(numbers) != 10 {
+		t.Fatalf("ReadFile devolveu %d números, esperado 10", len(numbers))
+	}
+
+	_, err = fsys.ReadFile("a", 0, 1001)
+	if err == nil {
+		t.Fatal("ReadFile além do fim deveria falhar")
+	}
+
+	err = fsys.RemoveFile("a")
+	if err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	if used := usedBlocks(fsys); used != before {
+		t.Fatalf("blocos em uso após remoção: %d, esperado %d", used, before)
+	}
+
+	_, err = fsys.Lookup("a")
+	if err == nil {
+		t.Fatal("arquivo removido ainda encontrado")
+	}
+}
+
+func TestOrderFile(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("dados", 700)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	_, err = fsys.OrderFile("dados", SortOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("OrderFile: %v", err)
+	}
+
+	numbers, err := fsys.ReadFile("dados", 0, 700)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !slices.IsSorted(numbers) {
+		t.Fatal("arquivo não ficou ordenado")
+	}
+}
+
+func TestConcatFiles(t *testing.T) {
+	fsys := newTestFS(t)
+
+	for _, name := range []string{"a", "b"} {
+		err := fsys.CreateFile(name, 300)
+		if err != nil {
+			t.Fatalf("CreateFile(%s): %v", name, err)
+		}
+	}
+
+	a, _ := fsys.ReadFile("a", 0, 300)
+	b, _ := fsys.ReadFile("b", 0, 300)
+
+	err := fsys.ConcatFiles("a", "b", "c")
+	if err != nil {
+		t.Fatalf("ConcatFiles: %v", err)
+	}
+
+	c, err := fsys.ReadFile("c", 0, 600)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !slices.Equal(c, append(a, b...)) {
+		t.Fatal("conteúdo concatenado difere das origens")
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := fsys.Lookup(name); err == nil {
+			t.Fatalf("origem %s ainda existe após concat", name)
+		}
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.MakeDirectory("/docs")
+	if err != nil {
+		t.Fatalf("MakeDirectory: %v", err)
+	}
+
+	err = fsys.MakeDirectory("/docs/sub")
+	if err != nil {
+		t.Fatalf("MakeDirectory: %v", err)
+	}
+
+	err = fsys.CreateFile("/docs/sub/x", 10)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	inodes, _, err := fsys.ListFiles("/docs/sub")
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(inodes) != 1 || inodes[0].Name() != "x" {
+		t.Fatalf("listagem inesperada: %v", inodes)
+	}
+
+	err = fsys.RemoveDirectory("/docs/sub")
+	if err == nil {
+		t.Fatal("rmdir de diretório não vazio deveria falhar")
+	}
+
+	err = fsys.RemoveFile("/docs/sub/../sub/x")
+	if err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+
+	err = fsys.RemoveDirectory("/docs/sub")
+	if err != nil {
+		t.Fatalf("RemoveDirectory: %v", err)
+	}
+}
+
+func TestRemountKeepsData(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("a", 50)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	want, _ := fsys.ReadFile("a", 0, 50)
+
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	remounted, err := MountDevice(fsys.dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+
+	got, err := remounted.ReadFile("a", 0, 50)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("conteúdo mudou após remontar")
+	}
+}
+
+func TestMountReadOnly(t *testing.T) {
+	fsys, filename := newConcurrentFS(t)
+
+	err := fsys.CreateFile("/a", 50)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	err = fsys.CreateFile("/c", 2000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	want, _ := fsys.ReadFile("/a", 0, 50)
+	before, _ := fsys.Lookup("/a")
+	fsys.Close()
+
+	// Vários leitores compartilham a imagem, mas ninguém a abre para escrita.
+	readers := make([]*FileSystem, 2)
+	for i := range readers {
+		readers[i], err = MountReadOnly(filename)
+		if err != nil {
+			t.Fatalf("MountReadOnly: %v", err)
+		}
+	}
+	_, err = Mount(filename)
+	if !errors.Is(err, device.ErrLocked) {
+		t.Fatalf("Mount deveria falhar com a imagem aberta para leitura: %v", err)
+	}
+
+	ro := readers[0]
+	got, err := ro.ReadFile("/a", 0, 50)
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	mutations := map[string]func() error{
+		"CreateFile":    func() error { return ro.CreateFile("/b", 10) },
+		"RemoveFile":    func() error { return ro.RemoveFile("/a") },
+		"OrderFile":     func() error { _, err := ro.OrderFile("/a", SortOptions{}); return err },
+		"ConcatFiles":   func() error { return ro.ConcatFiles("/a", "/a", "/b") },
+		"MakeDirectory": func() error { return ro.MakeDirectory("/d") },
+		"Chmod":         func() error { return ro.Chmod("/a", 0o600) },
+		"OpenFile":      func() error { _, err := ro.OpenFile("/a", os.O_WRONLY, 0); return err },
+	}
+	for name, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s deveria ser recusado: %v", name, err)
+		}
+	}
+
+	// bench-sort não tem onde gravar as runs e ordena só em memória.
+	results, err := ro.BenchSort("/a", 0)
+	if err != nil || len(results) != len(SortAlgorithms) {
+		t.Fatalf("BenchSort: %v", err)
+	}
+	for _, stats := range results {
+		if stats.Skipped || stats.IOBytes != 50*4 {
+			t.Errorf("BenchSort %s: estatísticas inesperadas %+v", stats.Algorithm, stats)
+		}
+	}
+	_, err = ro.BenchSort("/c", 3*1024)
+	if err == nil {
+		t.Error("BenchSort de arquivo maior que a memória deveria falhar")
+	}
+
+	for _, reader := range readers {
+		err = reader.Close()
+		if err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	fsys, err = Mount(filename)
+	if err != nil {
+		t.Fatalf("Mount: %v", err)
+	}
+	defer fsys.Close()
+
+	after, err := fsys.Lookup("/a")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if after.Atime != before.Atime || after.Size != before.Size {
+		t.Errorf("a montagem só de leitura alterou o inode: %+v, antes %+v", after, before)
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	fsys := newTestFS(t)
+	blockSize := fsys.sb.BlockSize
+
+	// A raiz só ganha um bloco na primeira entrada.
+	err := fsys.MakeDirectory("/docs")
+	if err != nil {
+		t.Fatalf("MakeDirectory: %v", err)
+	}
+
+	before := fsys.FreeSpace()
+	if max := (fsys.sb.NumBlocks - fsys.sb.firstDataBlock()) * blockSize; before <= 0 || before >= max {
+		t.Fatalf("espaço livre inesperado: %d de %d", before, max)
+	}
+
+	// 300 inteiros ocupam dois blocos de 1024 bytes, devolvidos na remoção.
+	err = fsys.CreateFile("/a", 300)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if free := fsys.FreeSpace(); free != before-2*blockSize {
+		t.Fatalf("espaço livre após create: %d, esperado %d", free, before-2*blockSize)
+	}
+	err = fsys.RemoveFile("/a")
+	if err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	if free := fsys.FreeSpace(); free != before {
+		t.Fatalf("espaço livre após remove: %d, esperado %d", free, before)
+	}
+}
+
+func TestCreateFileNoSpace(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("grande", 4<<20)
+	if err == nil {
+		t.Fatal("CreateFile maior que o disco deveria falhar")
+	}
+}
+
+func TestNewSuperBlockRejectsGeometry(t *testing.T) {
+	tests := []struct {
+		name                        string
+		diskSize, blockSize, inodes int64
+	}{
+		{"bloco", 4 << 20, 1000, 64},
+		{"inodes", 4 << 20, 1024, 0},
+		{"disco", 512, 1024, 64},
+		{"tabela maior que o disco", 4 << 20, 1024, (4<<20)/constants.InodeSize + 1},
+		{"tabela estoura", 4 << 20, 1024, 1 << 56},
+	}
+	for _, test := range tests {
+		_, err := NewSuperBlock(test.diskSize, test.blockSize, test.inodes)
+		if err == nil {
+			t.Errorf("%s: NewSuperBlock deveria recusar a geometria", test.name)
+		}
+	}
+}
+
+func TestMountRejectsInvalidImages(t *testing.T) {
+	fsys := newTestFS(t)
+	dev := fsys.dev
+
+	block := make([]byte, fsys.sb.BlockSize)
+	err := dev.ReadBlock(0, block)
+	if err != nil {
+		t.Fatalf("ReadBlock: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		dev    device.BlockDevice
+		mutate func(sb []byte)
+	}{
+		{"assinatura", dev, func(sb []byte) { copy(sb, "NOTJWFS!") }},
+		{"versão", dev, func(sb []byte) { sb[8] = 99 }},
+		{"geometria", dev, func(sb []byte) { sb[96]++ }},
+		{"inodes", dev, func(sb []byte) { binary.LittleEndian.PutUint64(sb[48:56], 1<<56) }},
+		{"truncada", device.NewMemoryDevice(fsys.sb.DiskSize / 2), func(sb []byte) {}},
+		{"vazia", device.NewMemoryDevice(0), nil},
+	}
+
+	for _, test := range tests {
+		if test.mutate != nil {
+			corrupted := slices.Clone(block)
+			test.mutate(corrupted)
+			err := test.dev.WriteBlock(0, corrupted)
+			if err != nil {
+				t.Fatalf("%s: WriteBlock: %v", test.name, err)
+			}
+		}
+
+		_, err := MountDevice(test.dev)
+		if err == nil {
+			t.Errorf("%s: MountDevice deveria recusar a imagem", test.name)
+		}
+	}
+}
+
+func TestInodeTimestamps(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("a", 100)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	created, _ := fsys.Lookup("a")
+	if created.Ctime == 0 || created.Mtime != created.Ctime || created.Mode != constants.DefaultFileMode {
+		t.Fatalf("metadados iniciais inesperados: %+v", created)
+	}
+
+	_, err = fsys.ReadFile("a", 0, 10)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	read, _ := fsys.Lookup("a")
+	if read.Atime <= created.Atime || read.Mtime != created.Mtime {
+		t.Fatalf("read deveria atualizar apenas o acesso: %+v", read)
+	}
+
+	_, err = fsys.OrderFile("a", SortOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("OrderFile: %v", err)
+	}
+	ordered, _ := fsys.Lookup("a")
+	if ordered.Mtime <= read.Mtime || ordered.Ctime != created.Ctime {
+		t.Fatalf("order deveria atualizar a modificação: %+v", ordered)
+	}
+}
@@ -0,0 +1,319 @@
+package filemanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+// FileSystem é uma imagem montada. Ela mantém o dispositivo aberto e uma cópia
+// do superbloco, do bitmap e da tabela de inodes, atualizada a cada commit.
+//
+// Os métodos podem ser chamados de várias goroutines. mu protege os
+// metadados em memória e é mantido por toda transação, do begin ao commit;
+// as leituras e gravações longas de dados são feitas fora dele, com o inode
+// do arquivo travado em inodeLocks. Quem precisa dos dois trava o inode
+// antes de mu.
+type FileSystem struct {
+	mu         sync.Mutex
+	inodeLocks []sync.RWMutex
+
+	dev device.BlockDevice
+	// buffers é o cache de blocos por onde passa todo acesso a dev
+	buffers *device.BufferCache
+	sb      SuperBlock
+	bitmap  []byte
+	inodes  []Inode
+
+	// dirty guarda os blocos confirmados e ainda não gravados por Sync.
+	// flushed é o bitmap que está no disco: um bloco liberado depois do último
+	// Sync não é reutilizado antes do próximo, porque no disco ele ainda
+	// pertence a outro arquivo ou diretório.
+	dirty   map[int64][]byte
+	flushed []byte
+
+	// reserved marca os blocos das áreas temporárias das ordenações em
+	// andamento, que ainda não estão no bitmap mas não podem ser alocados.
+	reserved []byte
+
+	// names indexa as entradas de cada diretório já consultado, por nome.
+	names      map[int64]map[string]nameEntry
+	cacheStats CacheStats
+
+	// dono atribuído aos arquivos e diretórios criados
+	uid uint32
+	gid uint32
+
+	// readOnly recusa qualquer alteração: a imagem foi aberta só para leitura
+	// e pode estar sendo lida por outros processos.
+	readOnly bool
+
+	// replayed conta os blocos que a montagem reaplicou do journal
+	replayed int
+}
+
+var ErrReadOnly = errors.New("sistema de arquivos montado só para leitura")
+
+// Mount abre a imagem para leitura e escrita. Enquanto ela estiver montada,
+// nenhum outro processo consegue abri-la.
+func Mount(filename string) (*FileSystem, error) {
+	return mount(filename, os.O_RDWR)
+}
+
+// MountReadOnly abre a imagem só para leitura, o que outros leitores também
+// podem fazer ao mesmo tempo. Uma transação que ficou no journal é aplicada
+// apenas em memória.
+func MountReadOnly(filename string) (*FileSystem, error) {
+	return mount(filename, os.O_RDONLY)
+}
+
+func mount(filename string, flag int) (*FileSystem, error) {
+	dev, err := device.OpenFileDevice(filename, flag)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, err := mountDevice(dev, flag&(os.O_WRONLY|os.O_RDWR) == 0)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// MountDevice monta dev para leitura e escrita, reaplicando antes uma
+// transação confirmada que tenha ficado no journal.
+func MountDevice(dev device.BlockDevice) (*FileSystem, error) {
+	return mountDevice(dev, false)
+}
+
+func mountDevice(dev device.BlockDevice, readOnly bool) (*FileSystem, error) {
+	sb, err := readSuperblock(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sb.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if dev.Size() < sb.DiskSize {
+		return nil, fmt.Errorf("imagem truncada: %d de %d bytes", dev.Size(), sb.DiskSize)
+	}
+
+	buffers := device.NewBufferCache(dev, sb.BlockSize, int(constants.DefaultBufferCache/sb.BlockSize))
+	fsys := &FileSystem{dev: buffers, buffers: buffers, sb: sb, readOnly: readOnly}
+
+	// O journal nunca guarda o superbloco, então sb continua valendo.
+	if !readOnly {
+		fsys.replayed, err = replayJournal(fsys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = fsys.loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	if readOnly {
+		err = fsys.loadJournal()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fsys, nil
+}
+
+// Replayed informa quantos blocos a montagem restaurou do journal.
+func (fsys *FileSystem) Replayed() int {
+	return fsys.replayed
+}
+
+// loadMetadata preenche o cache do bitmap e da tabela de inodes.
+func (fsys *FileSystem) loadMetadata() error {
+	sb := &fsys.sb
+
+	fsys.bitmap = make([]byte, sb.BitmapSize())
+	err := fsys.readAt(fsys.bitmap, sb.BitmapStart)
+	if err != nil {
+		return err
+	}
+
+	table := make([]byte, sb.MaxInodes*sb.InodeSize)
+	err = fsys.readAt(table, sb.InodeTableStart)
+	if err != nil {
+		return err
+	}
+
+	fsys.inodes = make([]Inode, sb.MaxInodes)
+	for i := range fsys.inodes {
+		fsys.inodes[i] = DeserializeInode(table[int64(i)*sb.InodeSize:])
+	}
+
+	fsys.flushed = slices.Clone(fsys.bitmap)
+	fsys.reserved = make([]byte, len(fsys.bitmap))
+	fsys.names = make(map[int64]map[string]nameEntry)
+	fsys.inodeLocks = make([]sync.RWMutex, sb.MaxInodes)
+	return nil
+}
+
+// Close grava os metadados pendentes e fecha o dispositivo.
+func (fsys *FileSystem) Close() error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	err := fsys.sync()
+	if closer, ok := fsys.dev.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+func (fsys *FileSystem) ReadOnly() bool {
+	return fsys.readOnly
+}
+
+func (fsys *FileSystem) Superblock() SuperBlock {
+	return fsys.sb
+}
+
+// FreeSpace devolve, em bytes, o espaço dos blocos de dados livres no bitmap.
+func (fsys *FileSystem) FreeSpace() int64 {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	var free int64
+	for b := fsys.sb.firstDataBlock(); b < fsys.sb.NumBlocks; b++ {
+		if !blockAllocated(fsys.bitmap, b) {
+			free++
+		}
+	}
+	return free * fsys.sb.BlockSize
+}
+
+// readAt lê do disco e sobrepõe os blocos sujos, que são mais recentes.
+func (fsys *FileSystem) readAt(p []byte, off int64) error {
+	err := readBytes(fsys.dev, fsys.sb.BlockSize, p, off)
+	if err != nil {
+		return err
+	}
+	fsys.copyDirty(p, off, false)
+	return nil
+}
+
+// writeAt grava direto no disco e atualiza os blocos sujos atingidos, para que
+// o próximo Sync não desfaça a escrita.
+func (fsys *FileSystem) writeAt(p []byte, off int64) error {
+	err := writeBytes(fsys.dev, fsys.sb.BlockSize, p, off)
+	if err != nil {
+		return err
+	}
+	fsys.copyDirty(p, off, true)
+	return nil
+}
+
+// readBytes lê um intervalo arbitrário de bytes do dispositivo. Os blocos
+// inteiros do meio do intervalo são lidos em uma única chamada.
+func readBytes(dev device.BlockDevice, blockSize int64, p []byte, off int64) error {
+	var block []byte
+	for n := int64(0); n < int64(len(p)); {
+		blockIndex := (off + n) / blockSize
+		inBlock := (off + n) % blockSize
+		chunk := min(int64(len(p))-n, blockSize-inBlock)
+
+		if chunk == blockSize {
+			chunk = (int64(len(p)) - n) / blockSize * blockSize
+			if err := dev.ReadBlocks(blockIndex, int(chunk/blockSize), p[n:n+chunk]); err != nil {
+				return err
+			}
+		} else {
+			if block == nil {
+				block = make([]byte, blockSize)
+			}
+			if err := dev.ReadBlock(blockIndex, block); err != nil {
+				return err
+			}
+			copy(p[n:n+chunk], block[inBlock:])
+		}
+		n += chunk
+	}
+	return nil
+}
+
+// writeBytes grava um intervalo arbitrário de bytes, lendo antes os blocos
+// que serão alterados apenas em parte. Os blocos inteiros são gravados em
+// uma única chamada.
+func writeBytes(dev device.BlockDevice, blockSize int64, p []byte, off int64) error {
+	var block []byte
+	for n := int64(0); n < int64(len(p)); {
+		blockIndex := (off + n) / blockSize
+		inBlock := (off + n) % blockSize
+		chunk := min(int64(len(p))-n, blockSize-inBlock)
+
+		if chunk == blockSize {
+			chunk = (int64(len(p)) - n) / blockSize * blockSize
+			if err := dev.WriteBlocks(blockIndex, int(chunk/blockSize), p[n:n+chunk]); err != nil {
+				return err
+			}
+		} else {
+			if block == nil {
+				block = make([]byte, blockSize)
+			}
+			if err := dev.ReadBlock(blockIndex, block); err != nil {
+				return err
+			}
+			copy(block[inBlock:], p[n:n+chunk])
+			if err := dev.WriteBlock(blockIndex, block); err != nil {
+				return err
+			}
+		}
+		n += chunk
+	}
+	return nil
+}
+
+func (fsys *FileSystem) cachedInode(ino int64) Inode {
+	fsys.cacheStats.InodeHits++
+	inode := fsys.inodes[ino]
+	inode.Extents = slices.Clone(inode.Extents)
+	return inode
+}
+
+// refreshCache aplica ao cache os blocos de metadados gravados por um commit.
+func (fsys *FileSystem) refreshCache(blocks map[int64][]byte) {
+	sb := &fsys.sb
+	bitmapEnd := sb.BitmapStart + sb.BitmapSize()
+	tableEnd := sb.InodeTableStart + sb.MaxInodes*sb.InodeSize
+
+	for blockIndex, block := range blocks {
+		start := blockIndex * sb.BlockSize
+		end := start + sb.BlockSize
+
+		if start < bitmapEnd && end > sb.BitmapStart {
+			lo, hi := max(start, sb.BitmapStart), min(end, bitmapEnd)
+			copy(fsys.bitmap[lo-sb.BitmapStart:hi-sb.BitmapStart], block[lo-start:hi-start])
+		}
+
+		if start < tableEnd && end > sb.InodeTableStart {
+			lo, hi := max(start, sb.InodeTableStart), min(end, tableEnd)
+			for off := lo; off < hi; off += sb.InodeSize {
+				ino := (off - sb.InodeTableStart) / sb.InodeSize
+				inode := DeserializeInode(block[off-start : off-start+sb.InodeSize])
+				// Um inode liberado ou reaproveitado perde o seu índice de nomes.
+				if inode.Type != fsys.inodes[ino].Type || inode.Ctime != fsys.inodes[ino].Ctime {
+					delete(fsys.names, ino)
+				}
+				fsys.inodes[ino] = inode
+			}
+		}
+	}
+}
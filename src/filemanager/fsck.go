@@ -0,0 +1,442 @@
+package filemanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+type FsckReport struct {
+	Problems []string
+	Repaired bool
+}
+
+// checker mantém em memória o estado do disco enquanto ele é verificado. As
+// correções são sempre aplicadas nessa cópia, para que um problema não gere
+// outros em cascata, e só são gravadas quando repair é verdadeiro.
+type checker struct {
+	fsys       *FileSystem
+	tx         *transaction
+	report     *FsckReport
+	inodes     []Inode
+	dirtyInode map[int64]bool
+	entries    map[int64][]DirEntry
+	dirtyDir   map[int64]bool
+	owner      []int64
+	visited    map[int64]bool
+}
+
+func (c *checker) problem(format string, args ...any) {
+	c.report.Problems = append(c.report.Problems, fmt.Sprintf(format, args...))
+}
+
+func Fsck(filename string, repair bool) (FsckReport, error) {
+	var report FsckReport
+
+	if repair {
+		replayed, err := ReplayJournal(filename)
+		if err != nil {
+			return report, err
+		}
+		if replayed > 0 {
+			report.Problems = append(report.Problems, fmt.Sprintf("journal com transação pendente (%d blocos), reaplicada", replayed))
+		}
+	}
+
+	flag := os.O_RDONLY
+	if repair {
+		flag = os.O_RDWR
+	}
+
+	superblock, err := ReadSuperblock(filename)
+	if err != nil {
+		return report, err
+	}
+
+	if err := superblock.validate(); err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("superbloco inválido: %v", err))
+
+		expected, err := superblock.rebuild()
+		info, statErr := os.Stat(filename)
+		if err != nil || statErr != nil || info.Size() != expected.DiskSize {
+			return report, errors.New("superbloco irrecuperável: geometria do disco desconhecida")
+		}
+		if !repair {
+			return report, nil
+		}
+
+		dev, err := device.OpenFileDevice(filename, os.O_RDWR)
+		if err != nil {
+			return report, err
+		}
+		err = InitializeSuperblock(dev, expected)
+		dev.Close()
+		if err != nil {
+			return report, err
+		}
+	}
+
+	fsys, err := mount(filename, flag)
+	if err != nil {
+		return report, err
+	}
+	defer fsys.Close()
+
+	c := &checker{
+		fsys:       fsys,
+		tx:         fsys.begin(),
+		report:     &report,
+		dirtyInode: make(map[int64]bool),
+		entries:    make(map[int64][]DirEntry),
+		dirtyDir:   make(map[int64]bool),
+		owner:      make([]int64, fsys.sb.NumBlocks),
+		visited:    make(map[int64]bool),
+	}
+	for i := range c.owner {
+		c.owner[i] = -1
+	}
+
+	header, err := readJournalHeader(fsys.dev, &fsys.sb)
+	if err != nil {
+		return report, err
+	}
+	if len(header.Blocks) > 0 {
+		c.problem("journal com transação pendente (%d blocos)", len(header.Blocks))
+	}
+
+	err = c.checkInodes()
+	if err != nil {
+		return report, err
+	}
+
+	err = c.checkTree()
+	if err != nil {
+		return report, err
+	}
+
+	c.checkOrphans()
+
+	bitmap, err := c.tx.readBitmap()
+	if err != nil {
+		return report, err
+	}
+
+	expected := c.expectedBitmap()
+	var unmarked, leaked int
+	for b := int64(0); b < fsys.sb.NumBlocks; b++ {
+		used, marked := blockAllocated(expected, b), blockAllocated(bitmap, b)
+		if used && !marked {
+			unmarked++
+		} else if marked && !used {
+			leaked++
+		}
+	}
+	if unmarked > 0 {
+		c.problem("%d blocos em uso estão marcados como livres no bitmap", unmarked)
+	}
+	if leaked > 0 {
+		c.problem("%d blocos marcados como ocupados não pertencem a nenhum arquivo", leaked)
+	}
+
+	if !repair || len(report.Problems) == 0 {
+		return report, nil
+	}
+
+	err = c.writeDirectories(expected)
+	if err != nil {
+		return report, err
+	}
+
+	// O fsck roda com o disco fora de uso, então grava direto sem journal.
+	for ino := range c.dirtyInode {
+		err = fsys.writeAt(SerializeInode(c.inodes[ino]), fsys.sb.inodeOffset(ino))
+		if err != nil {
+			return report, err
+		}
+	}
+
+	err = fsys.writeAt(expected, fsys.sb.BitmapStart)
+	if err != nil {
+		return report, err
+	}
+
+	err = fsys.dev.Sync()
+	if err != nil {
+		return report, err
+	}
+
+	report.Repaired = true
+	return report, nil
+}
+
+func (c *checker) checkInodes() error {
+	sb := &c.fsys.sb
+
+	c.inodes = make([]Inode, sb.MaxInodes)
+	for ino := int64(0); ino < sb.MaxInodes; ino++ {
+		inode, err := c.tx.readInode(ino)
+		if err != nil {
+			return err
+		}
+		c.inodes[ino] = inode
+	}
+
+	root := &c.inodes[constants.RootInode]
+	if !root.IsDir() {
+		c.problem("inode raiz não é um diretório")
+		*root = newInode("/", TypeDir, 0, 0)
+		c.dirtyInode[constants.RootInode] = true
+	}
+
+	// A tabela de contas não pertence a nenhum diretório; uma tabela perdida é
+	// recriada vazia, o que ainda permite entrar como root.
+	if ino := sb.AccountsInode; ino != constants.RootInode {
+		if ino < 0 || ino >= sb.MaxInodes {
+			return errors.New("superbloco aponta para uma tabela de contas inválida")
+		}
+		if c.inodes[ino].Type != TypeAccounts {
+			c.problem("inode %d da tabela de contas tem tipo %d, recriado vazio", ino, c.inodes[ino].Type)
+			c.inodes[ino] = newInode("", TypeAccounts, constants.RootUID, constants.RootGID)
+			c.inodes[ino].Mode = 0600
+			c.dirtyInode[ino] = true
+		}
+		c.visited[ino] = true
+	}
+
+	for ino := range c.inodes {
+		inode := &c.inodes[ino]
+		if inode.Type == TypeFree {
+			continue
+		}
+
+		isAccounts := int64(ino) == sb.AccountsInode && ino != constants.RootInode
+		if inode.Type != TypeFile && inode.Type != TypeDir && (inode.Type != TypeAccounts || !isAccounts) {
+			c.problem("inode %d tem tipo inválido %d", ino, inode.Type)
+			*inode = Inode{}
+			c.dirtyInode[int64(ino)] = true
+			continue
+		}
+
+		if bytes.IndexByte(inode.Filename[:], 0) < 0 {
+			c.problem("inode %d tem nome sem terminador", ino)
+			inode.Filename[len(inode.Filename)-1] = 0
+			c.dirtyInode[int64(ino)] = true
+		}
+
+		for i, extent := range inode.Extents {
+			if extent.Start < sb.firstDataBlock() || extent.Start+extent.Count > sb.NumBlocks {
+				c.problem("inode %d (%s): extent %v fora da área de dados", ino, inode.Name(), extent)
+				inode.Extents = inode.Extents[:i]
+				c.dirtyInode[int64(ino)] = true
+				break
+			}
+
+			conflict := int64(-1)
+			for b := extent.Start; b < extent.Start+extent.Count; b++ {
+				if c.owner[b] >= 0 {
+					conflict = b
+					break
+				}
+			}
+			if conflict >= 0 {
+				c.problem("inode %d (%s): bloco %d também pertence ao inode %d", ino, inode.Name(), conflict, c.owner[conflict])
+				inode.Extents = inode.Extents[:i]
+				c.dirtyInode[int64(ino)] = true
+				break
+			}
+
+			for b := extent.Start; b < extent.Start+extent.Count; b++ {
+				c.owner[b] = int64(ino)
+			}
+		}
+
+		capacity := totalBlocks(inode.Extents) * sb.BlockSize
+		if inode.IsDir() {
+			capacity = totalBlocks(inode.Extents) * (sb.BlockSize / constants.DirEntrySize)
+		} else if inode.Type == TypeAccounts {
+			capacity = totalBlocks(inode.Extents) * (sb.BlockSize / constants.AccountRecordSize)
+		}
+		if inode.Size > capacity || inode.Size < 0 {
+			c.problem("inode %d (%s): tamanho %d excede os blocos alocados", ino, inode.Name(), inode.Size)
+			inode.Size = capacity
+			c.dirtyInode[int64(ino)] = true
+		}
+	}
+
+	return nil
+}
+
+// checkTree percorre a árvore a partir da raiz validando cada entrada.
+func (c *checker) checkTree() error {
+	queue := []int64{constants.RootInode}
+	c.visited[constants.RootInode] = true
+
+	for len(queue) > 0 {
+		dirIno := queue[0]
+		queue = queue[1:]
+		dir := &c.inodes[dirIno]
+
+		entries, err := c.tx.readDirEntries(dir)
+		if err != nil {
+			return err
+		}
+
+		var kept []DirEntry
+		names := make(map[string]bool)
+		for _, entry := range entries {
+			if bytes.IndexByte(entry.Name[:], 0) < 0 {
+				c.problem("diretório %d: entrada com nome sem terminador", dirIno)
+				entry.Name[len(entry.Name)-1] = 0
+				c.dirtyDir[dirIno] = true
+			}
+
+			name := entry.name()
+			if entry.Inode < 0 || entry.Inode >= c.fsys.sb.MaxInodes || c.inodes[entry.Inode].Type == TypeFree {
+				c.problem("diretório %d: entrada '%s' aponta para inode livre ou inválido %d", dirIno, name, entry.Inode)
+				c.dirtyDir[dirIno] = true
+				continue
+			}
+
+			if name == "" || c.visited[entry.Inode] {
+				c.problem("diretório %d: entrada '%s' inválida ou repetida para o inode %d", dirIno, name, entry.Inode)
+				c.dirtyDir[dirIno] = true
+				continue
+			}
+
+			if names[name] {
+				newName := uniqueName(name, entry.Inode, names)
+				c.problem("diretório %d: nome duplicado '%s', renomeado para '%s'", dirIno, name, newName)
+				entry.Name = [32]byte{}
+				copy(entry.Name[:], newName)
+				name = newName
+				c.dirtyDir[dirIno] = true
+			}
+			names[name] = true
+
+			inode := &c.inodes[entry.Inode]
+			if inode.Name() != name {
+				c.problem("inode %d: nome '%s' difere da entrada de diretório '%s'", entry.Inode, inode.Name(), name)
+				inode.Filename = entry.Name
+				c.dirtyInode[entry.Inode] = true
+			}
+
+			c.visited[entry.Inode] = true
+			kept = append(kept, entry)
+			if inode.IsDir() {
+				queue = append(queue, entry.Inode)
+			}
+		}
+
+		c.entries[dirIno] = kept
+	}
+
+	return nil
+}
+
+// checkOrphans religa à raiz os inodes em uso que nenhum diretório alcança.
+func (c *checker) checkOrphans() {
+	names := make(map[string]bool)
+	for _, entry := range c.entries[constants.RootInode] {
+		names[entry.name()] = true
+	}
+
+	for ino := range c.inodes {
+		inode := &c.inodes[ino]
+		if inode.Type == TypeFree || c.visited[int64(ino)] {
+			continue
+		}
+
+		name := inode.Name()
+		if name == "" || names[name] {
+			name = uniqueName(name, int64(ino), names)
+		}
+		names[name] = true
+
+		c.problem("inode %d (%s) não pertence a nenhum diretório, religado em /%s", ino, inode.Name(), name)
+
+		var entry DirEntry
+		copy(entry.Name[:], name)
+		entry.Inode = int64(ino)
+		c.entries[constants.RootInode] = append(c.entries[constants.RootInode], entry)
+		c.dirtyDir[constants.RootInode] = true
+
+		inode.Filename = entry.Name
+		c.dirtyInode[int64(ino)] = true
+		c.visited[int64(ino)] = true
+	}
+}
+
+func uniqueName(name string, ino int64, taken map[string]bool) string {
+	for n := 0; ; n++ {
+		suffix := fmt.Sprintf("~%d", ino)
+		if n > 0 {
+			suffix = fmt.Sprintf("~%d.%d", ino, n)
+		}
+		base := name
+		if len(base)+len(suffix) >= constants.MaxFilenameLen {
+			base = base[:constants.MaxFilenameLen-1-len(suffix)]
+		}
+		if !taken[base+suffix] {
+			return base + suffix
+		}
+	}
+}
+
+func (c *checker) expectedBitmap() []byte {
+	bitmap := make([]byte, c.fsys.sb.BitmapSize())
+	for b := int64(0); b < c.fsys.sb.firstDataBlock(); b++ {
+		setBlock(bitmap, b, true)
+	}
+	for b, ino := range c.owner {
+		if ino >= 0 {
+			setBlock(bitmap, int64(b), true)
+		}
+	}
+	return bitmap
+}
+
+func (c *checker) writeDirectories(bitmap []byte) error {
+	for dirIno := range c.dirtyDir {
+		dir := &c.inodes[dirIno]
+		entries := c.entries[dirIno]
+
+		perBlock := c.fsys.sb.BlockSize / constants.DirEntrySize
+		needed := ceilDiv(int64(len(entries)), perBlock)
+		if missing := needed - totalBlocks(dir.Extents); missing > 0 {
+			extents, err := c.fsys.allocateExtents(bitmap, missing)
+			if err != nil {
+				return err
+			}
+
+			dir.Extents, err = appendExtents(dir.Extents, extents)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := int64(0); i < max(dir.Size, int64(len(entries))); i++ {
+			var entry DirEntry
+			if i < int64(len(entries)) {
+				entry = entries[i]
+			}
+
+			offset, err := dir.dataOffset(c.fsys.sb.BlockSize, i*constants.DirEntrySize)
+			if err != nil {
+				return err
+			}
+
+			err = c.fsys.writeAt(serializeDirEntry(entry), offset)
+			if err != nil {
+				return err
+			}
+		}
+
+		dir.Size = int64(len(entries))
+		c.dirtyInode[dirIno] = true
+	}
+	return nil
+}
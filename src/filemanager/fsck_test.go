@@ -0,0 +1,180 @@
+package filemanager
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+// fsckImage é um disco com dois arquivos, /a e /b, de dois blocos cada, que
+// os casos de TestFsckRepairs corrompem direto na imagem.
+type fsckImage struct {
+	t    *testing.T
+	fsys *FileSystem
+	inos map[string]int64
+}
+
+func (img *fsckImage) inode(name string) Inode {
+	return img.fsys.inodes[img.inos[name]]
+}
+
+func (img *fsckImage) writeInode(name string, inode Inode) {
+	err := img.fsys.writeAt(SerializeInode(inode), img.fsys.sb.inodeOffset(img.inos[name]))
+	if err != nil {
+		img.t.Fatalf("writeAt: %v", err)
+	}
+}
+
+// writeEntry troca a entrada de name na raiz.
+func (img *fsckImage) writeEntry(name string, entry DirEntry) {
+	root := img.fsys.inodes[constants.RootInode]
+	entries, err := img.fsys.begin().readDirEntries(&root)
+	if err != nil {
+		img.t.Fatalf("readDirEntries: %v", err)
+	}
+
+	i := slices.IndexFunc(entries, func(e DirEntry) bool { return e.name() == name })
+	offset, err := root.dataOffset(img.fsys.sb.BlockSize, int64(i)*constants.DirEntrySize)
+	if err != nil {
+		img.t.Fatalf("dataOffset: %v", err)
+	}
+	err = img.fsys.writeAt(serializeDirEntry(entry), offset)
+	if err != nil {
+		img.t.Fatalf("writeAt: %v", err)
+	}
+}
+
+func TestFsckRepairs(t *testing.T) {
+	unterminated := [32]byte{}
+	for i := range unterminated {
+		unterminated[i] = 'x'
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(img *fsckImage) []string
+	}{
+		{"extents sobrepostos", func(img *fsckImage) []string {
+			a, b := img.inode("a"), img.inode("b")
+			b.Extents = []Extent{a.Extents[0]}
+			img.writeInode("b", b)
+			return []string{
+				fmt.Sprintf("inode %d (b): bloco %d também pertence ao inode %d", img.inos["b"], a.Extents[0].Start, img.inos["a"]),
+				fmt.Sprintf("inode %d (b): tamanho 1200 excede os blocos alocados", img.inos["b"]),
+				"2 blocos marcados como ocupados não pertencem a nenhum arquivo",
+			}
+		}},
+		{"blocos além do disco", func(img *fsckImage) []string {
+			b := img.inode("b")
+			b.Extents = []Extent{{Start: img.fsys.sb.NumBlocks - 1, Count: 2}}
+			img.writeInode("b", b)
+			return []string{
+				fmt.Sprintf("inode %d (b): extent {%d 2} fora da área de dados", img.inos["b"], img.fsys.sb.NumBlocks-1),
+				fmt.Sprintf("inode %d (b): tamanho 1200 excede os blocos alocados", img.inos["b"]),
+				"2 blocos marcados como ocupados não pertencem a nenhum arquivo",
+			}
+		}},
+		{"nomes duplicados", func(img *fsckImage) []string {
+			b := img.inode("b")
+			copy(b.Filename[:], "a")
+			img.writeInode("b", b)
+			img.writeEntry("b", DirEntry{Name: b.Filename, Inode: img.inos["b"]})
+			renamed := fmt.Sprintf("a~%d", img.inos["b"])
+			return []string{
+				fmt.Sprintf("diretório %d: nome duplicado 'a', renomeado para '%s'", constants.RootInode, renamed),
+				fmt.Sprintf("inode %d: nome 'a' difere da entrada de diretório '%s'", img.inos["b"], renamed),
+			}
+		}},
+		{"nomes sem terminador", func(img *fsckImage) []string {
+			b := img.inode("b")
+			b.Filename = unterminated
+			img.writeInode("b", b)
+			img.writeEntry("b", DirEntry{Name: unterminated, Inode: img.inos["b"]})
+			return []string{
+				fmt.Sprintf("inode %d tem nome sem terminador", img.inos["b"]),
+				fmt.Sprintf("diretório %d: entrada com nome sem terminador", constants.RootInode),
+			}
+		}},
+		{"bitmap divergente", func(img *fsckImage) []string {
+			bitmap := slices.Clone(img.fsys.bitmap)
+			setBlock(bitmap, img.inode("a").Extents[0].Start, false)
+			setBlock(bitmap, img.fsys.sb.NumBlocks-1, true)
+			err := img.fsys.writeAt(bitmap, img.fsys.sb.BitmapStart)
+			if err != nil {
+				img.t.Fatalf("writeAt: %v", err)
+			}
+			return []string{
+				"1 blocos em uso estão marcados como livres no bitmap",
+				"1 blocos marcados como ocupados não pertencem a nenhum arquivo",
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys, filename := newConcurrentFS(t)
+			for _, name := range []string{"/a", "/b"} {
+				err := fsys.CreateFile(name, 300)
+				if err != nil {
+					t.Fatalf("CreateFile: %v", err)
+				}
+			}
+			want, err := fsys.ReadFile("/a", 0, 300)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			err = fsys.Close()
+			if err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			fsys, err = Mount(filename)
+			if err != nil {
+				t.Fatalf("Mount: %v", err)
+			}
+			img := &fsckImage{t: t, fsys: fsys, inos: make(map[string]int64)}
+			for _, name := range []string{"a", "b"} {
+				img.inos[name], _, err = fsys.begin().resolvePath("/" + name)
+				if err != nil {
+					t.Fatalf("resolvePath: %v", err)
+				}
+			}
+			problems := test.corrupt(img)
+			err = fsys.Close()
+			if err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			report, err := Fsck(filename, false)
+			if err != nil {
+				t.Fatalf("Fsck: %v", err)
+			}
+			if !slices.Equal(report.Problems, problems) {
+				t.Fatalf("problemas encontrados:\n%s\nesperados:\n%s", strings.Join(report.Problems, "\n"), strings.Join(problems, "\n"))
+			}
+
+			report, err = Fsck(filename, true)
+			if err != nil || !report.Repaired || !slices.Equal(report.Problems, problems) {
+				t.Fatalf("Fsck com reparo: %+v, %v", report, err)
+			}
+
+			report, err = Fsck(filename, false)
+			if err != nil || len(report.Problems) > 0 {
+				t.Fatalf("problemas após o reparo: %v, %v", report.Problems, err)
+			}
+
+			fsys, err = Mount(filename)
+			if err != nil {
+				t.Fatalf("Mount: %v", err)
+			}
+			defer fsys.Close()
+			got, err := fsys.ReadFile("/a", 0, 300)
+			if err != nil || !slices.Equal(got, want) {
+				t.Fatalf("/a mudou com o reparo: %v", err)
+			}
+		})
+	}
+}
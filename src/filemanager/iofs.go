@@ -0,0 +1,233 @@
+package filemanager
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FS expõe uma imagem montada pela interface io/fs, para uso com
+// http.FileServer, template.ParseFS, fs.WalkDir e afins. As permissões
+// continuam sendo as do usuário da montagem.
+type FS struct {
+	mount *FileSystem
+}
+
+var (
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+)
+
+func NewFS(fsys *FileSystem) *FS {
+	return &FS{mount: fsys}
+}
+
+// fileInfo guarda o nome à parte porque o inode da raiz se chama "/" e io/fs
+// espera ".".
+type fileInfo struct {
+	name  string
+	inode Inode
+}
+
+func (info *fileInfo) Name() string       { return info.name }
+func (info *fileInfo) Size() int64        { return info.inode.Size }
+func (info *fileInfo) Mode() fs.FileMode  { return info.inode.FileMode() }
+func (info *fileInfo) ModTime() time.Time { return time.Unix(0, info.inode.Mtime) }
+func (info *fileInfo) IsDir() bool        { return info.inode.IsDir() }
+func (info *fileInfo) Sys() any           { return info.inode }
+
+// pathError traduz os erros do sistema de arquivos para os de io/fs, mantendo
+// a mensagem original nos demais casos.
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		err = fs.ErrNotExist
+	case errors.Is(err, ErrPermission):
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (fsys *FS) resolve(op, name string) (Inode, error) {
+	if !fs.ValidPath(name) {
+		return Inode{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	inode, err := fsys.mount.Lookup(name)
+	if err != nil {
+		return Inode{}, pathError(op, name, err)
+	}
+	return inode, nil
+}
+
+func (fsys *FS) Open(name string) (fs.File, error) {
+	inode, err := fsys.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if inode.IsDir() {
+		return &dirFile{fsys: fsys, name: name, info: &fileInfo{name: path.Base(name), inode: inode}}, nil
+	}
+
+	f, err := fsys.mount.Open(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &file{File: f, name: path.Base(name)}, nil
+}
+
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	inode, err := fsys.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), inode: inode}, nil
+}
+
+// ReadDir devolve as entradas ordenadas por nome, como fs.ReadDir exige.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	inode, err := fsys.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fsys.readDir(&inode)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (fsys *FS) readDir(dir *Inode) ([]fs.DirEntry, error) {
+	if !dir.IsDir() {
+		return nil, errors.New("não é um diretório")
+	}
+
+	fsys.mount.mu.Lock()
+	defer fsys.mount.mu.Unlock()
+
+	tx := fsys.mount.begin()
+
+	err := tx.checkAccess(dir, permRead)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := tx.readDirEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		inode, err := tx.readInode(entry.Inode)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fs.FileInfoToDirEntry(&fileInfo{name: entry.name(), inode: inode}))
+	}
+	return result, nil
+}
+
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := fsys.mount.Open(name)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	defer f.Close()
+
+	inode, err := f.Stat()
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+
+	data := make([]byte, inode.Size)
+	_, err = f.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// file adapta File, cujo Stat devolve o Inode, à interface fs.File.
+type file struct {
+	*File
+	name string
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	inode, err := f.File.Stat()
+	if err != nil {
+		return nil, pathError("stat", f.name, err)
+	}
+	return &fileInfo{name: f.name, inode: inode}, nil
+}
+
+// dirFile é um diretório aberto; as entradas são lidas na primeira chamada a
+// ReadDir e entregues aos poucos nas seguintes.
+type dirFile struct {
+	fsys    *FS
+	name    string
+	info    *fileInfo
+	entries []fs.DirEntry
+	read    bool
+	closed  bool
+}
+
+func (dir *dirFile) Stat() (fs.FileInfo, error) {
+	return dir.info, nil
+}
+
+func (dir *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.name, Err: errors.New("é um diretório")}
+}
+
+func (dir *dirFile) Close() error {
+	if dir.closed {
+		return &fs.PathError{Op: "close", Path: dir.name, Err: fs.ErrClosed}
+	}
+	dir.closed = true
+	return nil
+}
+
+func (dir *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if dir.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: dir.name, Err: fs.ErrClosed}
+	}
+
+	if !dir.read {
+		entries, err := dir.fsys.readDir(&dir.info.inode)
+		if err != nil {
+			return nil, pathError("readdir", dir.name, err)
+		}
+		dir.entries = entries
+		dir.read = true
+	}
+
+	if n <= 0 {
+		entries := dir.entries
+		dir.entries = nil
+		return entries, nil
+	}
+
+	if len(dir.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(dir.entries))
+	entries := dir.entries[:n]
+	dir.entries = dir.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,67 @@
+package filemanager
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.MakeDirectory("/docs")
+	if err != nil {
+		t.Fatalf("MakeDirectory: %v", err)
+	}
+	err = fsys.MakeDirectory("/docs/vazio")
+	if err != nil {
+		t.Fatalf("MakeDirectory: %v", err)
+	}
+
+	files := map[string]string{
+		"leia.txt":      "jwfs\n",
+		"docs/a.txt":    "primeiro arquivo",
+		"docs/zero.bin": "",
+		"docs/grande":   string(make([]byte, 5000)),
+	}
+	for name, content := range files {
+		f, err := fsys.Create(name)
+		if err != nil {
+			t.Fatalf("Create(%s): %v", name, err)
+		}
+		_, err = f.Write([]byte(content))
+		if err != nil {
+			t.Fatalf("Write(%s): %v", name, err)
+		}
+		f.Close()
+	}
+
+	err = fstest.TestFS(NewFS(fsys), "leia.txt", "docs/a.txt", "docs/zero.bin", "docs/grande", "docs/vazio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewFS(fsys).Open("nada")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Open de arquivo inexistente: %v", err)
+	}
+
+	err = fsys.Chmod("/docs/a.txt", 0600)
+	if err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	err = fsys.AddUser("alice", "", "senha", false)
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	err = fsys.Login("alice", "senha")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	_, err = fs.ReadFile(NewFS(fsys), "docs/a.txt")
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("leitura sem permissão: %v", err)
+	}
+}
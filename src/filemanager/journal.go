@@ -0,0 +1,376 @@
+package filemanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/Jonaires777/src/device"
+)
+
+const journalMagic = "JWFSJRNL"
+
+// journalHeaderSize cobre magic, sequência, quantidade de blocos e checksum;
+// em seguida vêm os números dos blocos registrados.
+const journalHeaderSize = 24
+
+type readWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// transaction acumula em memória as escritas de metadados de uma operação.
+// Nada chega às posições definitivas antes de Sync gravar o journal. dirs
+// guarda os diretórios cujas entradas a transação alterou.
+type transaction struct {
+	fsys   *FileSystem
+	blocks map[int64][]byte
+	dirs   map[int64]bool
+}
+
+func (fsys *FileSystem) begin() *transaction {
+	return &transaction{fsys: fsys, blocks: make(map[int64][]byte), dirs: make(map[int64]bool)}
+}
+
+func (tx *transaction) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		blockSize := tx.fsys.sb.BlockSize
+		blockIndex := (off + int64(n)) / blockSize
+		inBlock := (off + int64(n)) % blockSize
+		chunk := int(min(int64(len(p)-n), blockSize-inBlock))
+
+		if block, ok := tx.blocks[blockIndex]; ok {
+			copy(p[n:n+chunk], block[inBlock:])
+		} else if err := tx.fsys.readAt(p[n:n+chunk], off+int64(n)); err != nil {
+			return n, err
+		}
+		n += chunk
+	}
+	return n, nil
+}
+
+func (tx *transaction) WriteAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		blockSize := tx.fsys.sb.BlockSize
+		blockIndex := (off + int64(n)) / blockSize
+		inBlock := (off + int64(n)) % blockSize
+		chunk := int(min(int64(len(p)-n), blockSize-inBlock))
+
+		block, ok := tx.blocks[blockIndex]
+		if !ok {
+			block = make([]byte, blockSize)
+			if err := tx.fsys.readBlock(blockIndex, block); err != nil {
+				return n, err
+			}
+
+			// Blocos que não mudam não ocupam espaço no journal.
+			if bytes.Equal(block[inBlock:inBlock+int64(chunk)], p[n:n+chunk]) {
+				n += chunk
+				continue
+			}
+
+			if len(tx.blocks) == tx.fsys.sb.maxJournalEntries() {
+				return n, errors.New("transação excede o tamanho do journal")
+			}
+			tx.blocks[blockIndex] = block
+		}
+
+		copy(block[inBlock:], p[n:n+chunk])
+		n += chunk
+	}
+	return n, nil
+}
+
+// commit aplica a transação ao cache de metadados. Os blocos ficam sujos em
+// memória até o próximo Sync; se não couberem no journal junto com os que já
+// estão pendentes, estes são gravados antes.
+func (tx *transaction) commit() error {
+	if len(tx.blocks) == 0 {
+		return nil
+	}
+
+	fsys := tx.fsys
+	if fsys.readOnly {
+		return ErrReadOnly
+	}
+
+	pending := len(fsys.dirty)
+	for blockIndex := range tx.blocks {
+		if _, ok := fsys.dirty[blockIndex]; !ok {
+			pending++
+		}
+	}
+	if pending > fsys.sb.maxJournalEntries() {
+		err := fsys.sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	fsys.refreshCache(tx.blocks)
+	for dirIno := range tx.dirs {
+		delete(fsys.names, dirIno)
+	}
+
+	if fsys.dirty == nil {
+		fsys.dirty = make(map[int64][]byte)
+	}
+	for blockIndex, block := range tx.blocks {
+		fsys.dirty[blockIndex] = block
+	}
+	return nil
+}
+
+// Sync grava os blocos sujos como uma única transação: primeiro as imagens no
+// journal, depois o cabeçalho que a torna válida e só então os blocos nas
+// posições finais. Os dados pendentes no cache de blocos vão junto.
+func (fsys *FileSystem) Sync() error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	return fsys.sync()
+}
+
+func (fsys *FileSystem) sync() error {
+	// Numa montagem só de leitura, dirty só tem a transação do journal.
+	if fsys.readOnly {
+		return nil
+	}
+	if len(fsys.dirty) == 0 {
+		return fsys.dev.Sync()
+	}
+
+	header, err := writeJournal(fsys.dev, &fsys.sb, fsys.dirty)
+	if err != nil {
+		return err
+	}
+
+	err = checkpointJournal(fsys, header, fsys.dirty)
+	if err != nil {
+		return err
+	}
+
+	fsys.dirty = nil
+	fsys.flushed = slices.Clone(fsys.bitmap)
+	fsys.cacheStats.Flushes++
+	return nil
+}
+
+// writeJournal grava blocks no journal de sb como uma transação confirmada,
+// sem aplicá-la: primeiro as imagens e depois o cabeçalho que as valida.
+func writeJournal(dev device.BlockDevice, sb *SuperBlock, blocks map[int64][]byte) (journalHeader, error) {
+	blockNumbers := make([]int64, 0, len(blocks))
+	for blockIndex := range blocks {
+		blockNumbers = append(blockNumbers, blockIndex)
+	}
+	sort.Slice(blockNumbers, func(i, j int) bool { return blockNumbers[i] < blockNumbers[j] })
+
+	header, err := readJournalHeader(dev, sb)
+	if err != nil {
+		return header, err
+	}
+
+	for i, blockIndex := range blockNumbers {
+		err := dev.WriteBlock(sb.journalBlock(int64(i)+1), blocks[blockIndex])
+		if err != nil {
+			return header, err
+		}
+	}
+
+	err = dev.Sync()
+	if err != nil {
+		return header, err
+	}
+
+	header.Sequence++
+	header.Blocks = blockNumbers
+	header.Checksum = journalChecksum(header, blocks)
+
+	err = dev.WriteBlock(sb.journalBlock(0), serializeJournalHeader(sb, header))
+	if err != nil {
+		return header, err
+	}
+
+	return header, dev.Sync()
+}
+
+type journalHeader struct {
+	Sequence uint64
+	Checksum uint32
+	Blocks   []int64
+}
+
+func serializeJournalHeader(sb *SuperBlock, header journalHeader) []byte {
+	data := make([]byte, sb.BlockSize)
+	copy(data[0:8], journalMagic)
+	binary.LittleEndian.PutUint64(data[8:16], header.Sequence)
+	binary.LittleEndian.PutUint32(data[16:20], uint32(len(header.Blocks)))
+	binary.LittleEndian.PutUint32(data[20:24], header.Checksum)
+	for i, blockIndex := range header.Blocks {
+		offset := journalHeaderSize + i*8
+		binary.LittleEndian.PutUint64(data[offset:offset+8], uint64(blockIndex))
+	}
+	return data
+}
+
+func readJournalHeader(dev device.BlockDevice, sb *SuperBlock) (journalHeader, error) {
+	data := make([]byte, sb.BlockSize)
+	err := dev.ReadBlock(sb.journalBlock(0), data)
+	if err != nil {
+		return journalHeader{}, err
+	}
+
+	var header journalHeader
+	if string(data[0:8]) != journalMagic {
+		return header, nil
+	}
+
+	header.Sequence = binary.LittleEndian.Uint64(data[8:16])
+	count := int(binary.LittleEndian.Uint32(data[16:20]))
+	header.Checksum = binary.LittleEndian.Uint32(data[20:24])
+	if count > sb.maxJournalEntries() {
+		return journalHeader{Sequence: header.Sequence}, nil
+	}
+
+	for i := 0; i < count; i++ {
+		offset := journalHeaderSize + i*8
+		header.Blocks = append(header.Blocks, int64(binary.LittleEndian.Uint64(data[offset:offset+8])))
+	}
+	return header, nil
+}
+
+func journalChecksum(header journalHeader, blocks map[int64][]byte) uint32 {
+	crc := crc32.NewIEEE()
+	var number [8]byte
+	binary.LittleEndian.PutUint64(number[:], header.Sequence)
+	crc.Write(number[:])
+	for _, blockIndex := range header.Blocks {
+		binary.LittleEndian.PutUint64(number[:], uint64(blockIndex))
+		crc.Write(number[:])
+		crc.Write(blocks[blockIndex])
+	}
+	return crc.Sum32()
+}
+
+// checkpointJournal aplica os blocos de uma transação confirmada e esvazia o
+// journal, mantendo o número de sequência.
+func checkpointJournal(fsys *FileSystem, header journalHeader, blocks map[int64][]byte) error {
+	for _, blockIndex := range header.Blocks {
+		err := fsys.dev.WriteBlock(blockIndex, blocks[blockIndex])
+		if err != nil {
+			return err
+		}
+	}
+
+	err := fsys.dev.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = fsys.dev.WriteBlock(fsys.sb.journalBlock(0), serializeJournalHeader(&fsys.sb, journalHeader{Sequence: header.Sequence}))
+	if err != nil {
+		return err
+	}
+
+	return fsys.dev.Sync()
+}
+
+func InitializeJournal(dev device.BlockDevice, sb SuperBlock) error {
+	return dev.WriteBlock(sb.journalBlock(0), serializeJournalHeader(&sb, journalHeader{}))
+}
+
+// ReplayJournal reaplica uma transação confirmada que não chegou a ser
+// totalmente gravada, devolvendo quantos blocos foram restaurados. Mount já
+// faz isso; aqui a imagem é só montada e fechada.
+func ReplayJournal(filename string) (int, error) {
+	fsys, err := Mount(filename)
+	if err != nil {
+		return 0, err
+	}
+	return fsys.replayed, fsys.Close()
+}
+
+// replayJournal só usa o dispositivo e o superbloco de fsys, então também
+// serve para imagens que ainda não podem ser montadas, como durante o upgrade.
+func replayJournal(fsys *FileSystem) (int, error) {
+	header, blocks, err := readJournal(fsys)
+	if err != nil || len(blocks) == 0 {
+		return 0, err
+	}
+
+	// Um cabeçalho com checksum inválido indica que a queda ocorreu antes do
+	// commit; a transação é descartada e os metadados antigos continuam valendo.
+	if journalChecksum(header, blocks) != header.Checksum {
+		err = fsys.dev.WriteBlock(fsys.sb.journalBlock(0), serializeJournalHeader(&fsys.sb, journalHeader{Sequence: header.Sequence}))
+		if err != nil {
+			return 0, err
+		}
+		return 0, fsys.dev.Sync()
+	}
+
+	err = checkJournalBlocks(&fsys.sb, header)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkpointJournal(fsys, header, blocks)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(header.Blocks), nil
+}
+
+// loadJournal põe nos blocos sujos a transação confirmada que ficou no
+// journal, sem gravá-la, para que uma montagem só de leitura veja o mesmo que
+// uma de leitura e escrita, que a reaplica.
+func (fsys *FileSystem) loadJournal() error {
+	header, blocks, err := readJournal(fsys)
+	if err != nil || len(blocks) == 0 || journalChecksum(header, blocks) != header.Checksum {
+		return err
+	}
+
+	err = checkJournalBlocks(&fsys.sb, header)
+	if err != nil {
+		return err
+	}
+
+	fsys.dirty = blocks
+	fsys.refreshCache(blocks)
+	return nil
+}
+
+// readJournal lê o cabeçalho e as cópias dos blocos guardadas no journal.
+func readJournal(fsys *FileSystem) (journalHeader, map[int64][]byte, error) {
+	header, err := readJournalHeader(fsys.dev, &fsys.sb)
+	if err != nil {
+		return header, nil, err
+	}
+
+	blocks := make(map[int64][]byte, len(header.Blocks))
+	for i, blockIndex := range header.Blocks {
+		block := make([]byte, fsys.sb.BlockSize)
+		err := fsys.dev.ReadBlock(fsys.sb.journalBlock(int64(i)+1), block)
+		if err != nil {
+			return header, nil, err
+		}
+		blocks[blockIndex] = block
+	}
+	return header, blocks, nil
+}
+
+func checkJournalBlocks(sb *SuperBlock, header journalHeader) error {
+	for _, blockIndex := range header.Blocks {
+		offset := blockIndex * sb.BlockSize
+		if blockIndex < 0 || blockIndex >= sb.NumBlocks ||
+			(offset >= sb.JournalStart && offset < sb.DataStart) {
+			return errors.New("journal referencia bloco inválido")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package filemanager
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Jonaires777/src/device"
+)
+
+// pendingJournal monta um disco com /velho já gravado e cria /novo, cuja
+// transação chega ao journal como confirmada mas não é aplicada, como numa
+// queda logo depois do cabeçalho.
+func pendingJournal(t *testing.T) (device.BlockDevice, *FileSystem, journalHeader) {
+	t.Helper()
+
+	dev := device.NewMemoryDevice(4 << 20)
+	err := Format(dev, 1024, 64)
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+
+	err = fsys.CreateFile("/velho", 50)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	err = fsys.CreateFile("/novo", 300)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	header, err := writeJournal(fsys.dev, &fsys.sb, fsys.dirty)
+	if err != nil {
+		t.Fatalf("writeJournal: %v", err)
+	}
+	return dev, fsys, header
+}
+
+func TestMountReplaysJournal(t *testing.T) {
+	dev, crashed, header := pendingJournal(t)
+	want, err := crashed.ReadFile("/novo", 0, 300)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+	if fsys.Replayed() != len(header.Blocks) {
+		t.Fatalf("blocos reaplicados: %d, esperado %d", fsys.Replayed(), len(header.Blocks))
+	}
+	got, err := fsys.ReadFile("/novo", 0, 300)
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("transação do journal não foi reaplicada: %v", err)
+	}
+
+	// A transação já está no lugar: o journal fica vazio e um Sync seguinte
+	// não a desfaz.
+	pending, err := readJournalHeader(dev, &fsys.sb)
+	if err != nil || len(pending.Blocks) != 0 || pending.Sequence != header.Sequence {
+		t.Fatalf("journal após a reaplicação: %+v, %v", pending, err)
+	}
+	err = fsys.CreateFile("/outro", 10)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	err = fsys.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	fsys = mustRemount(t, fsys)
+	if fsys.Replayed() != 0 {
+		t.Fatalf("journal reaplicado de novo: %d blocos", fsys.Replayed())
+	}
+	for _, name := range []string{"/velho", "/novo", "/outro"} {
+		_, err = fsys.Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup(%s): %v", name, err)
+		}
+	}
+}
+
+func TestMountDiscardsCorruptJournal(t *testing.T) {
+	dev, crashed, header := pendingJournal(t)
+
+	// Uma cópia diferente da que o checksum cobre: a queda ocorreu antes de
+	// o cabeçalho valer, então a transação é descartada.
+	block := make([]byte, crashed.sb.BlockSize)
+	for i := range block {
+		block[i] = 0xAA
+	}
+	err := dev.WriteBlock(crashed.sb.journalBlock(1), block)
+	if err != nil {
+		t.Fatalf("WriteBlock: %v", err)
+	}
+
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+	if fsys.Replayed() != 0 {
+		t.Fatalf("journal inválido reaplicado: %d blocos", fsys.Replayed())
+	}
+	_, err = fsys.Lookup("/novo")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("arquivo da transação descartada: %v", err)
+	}
+	_, err = fsys.ReadFile("/velho", 0, 50)
+	if err != nil {
+		t.Fatalf("metadados anteriores ao journal: %v", err)
+	}
+
+	pending, err := readJournalHeader(dev, &fsys.sb)
+	if err != nil || len(pending.Blocks) != 0 || pending.Sequence != header.Sequence {
+		t.Fatalf("journal após o descarte: %+v, %v", pending, err)
+	}
+}
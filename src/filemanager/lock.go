@@ -0,0 +1,110 @@
+package filemanager
+
+import (
+	"slices"
+	"time"
+)
+
+// lockFiles trava os inodes a que os caminhos se referem, para escrita ou
+// para leitura, e devolve a função que os destrava. Os inodes são travados
+// em ordem crescente, para que duas operações nunca esperem uma pela outra.
+// Como os caminhos são resolvidos antes de os inodes estarem travados, eles
+// são conferidos de novo depois; se mudaram nesse meio-tempo, tudo recomeça.
+func (fsys *FileSystem) lockFiles(write bool, filenames ...string) (func(), error) {
+	for {
+		inos, err := fsys.resolveInodes(filenames)
+		if err != nil {
+			return nil, err
+		}
+
+		locked := slices.Compact(slices.Sorted(slices.Values(inos)))
+		for _, ino := range locked {
+			if write {
+				fsys.inodeLocks[ino].Lock()
+			} else {
+				fsys.inodeLocks[ino].RLock()
+			}
+		}
+		unlock := func() {
+			for _, ino := range locked {
+				if write {
+					fsys.inodeLocks[ino].Unlock()
+				} else {
+					fsys.inodeLocks[ino].RUnlock()
+				}
+			}
+		}
+
+		current, err := fsys.resolveInodes(filenames)
+		if err == nil && slices.Equal(current, inos) {
+			return unlock, nil
+		}
+		unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (fsys *FileSystem) resolveInodes(filenames []string) ([]int64, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+	inos := make([]int64, len(filenames))
+	for i, filename := range filenames {
+		ino, _, err := tx.resolvePath(filename)
+		if err != nil {
+			return nil, err
+		}
+		inos[i] = ino
+	}
+	return inos, nil
+}
+
+// openFile resolve filename e verifica as permissões pedidas. O inode já deve
+// estar travado por lockFiles.
+func (fsys *FileSystem) openFile(filename string, want uint32) (int64, Inode, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+
+	ino, inode, err := tx.resolveFile(filename)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+
+	err = tx.checkAccess(&inode, want)
+	if err != nil {
+		return -1, Inode{}, err
+	}
+	return ino, inode, nil
+}
+
+// touch grava o tempo de acesso de um arquivo lido, exceto numa montagem só
+// de leitura. O inode é relido porque, com o arquivo travado só para leitura,
+// outra operação pode tê-lo alterado.
+func (fsys *FileSystem) touch(ino int64) error {
+	if fsys.readOnly {
+		return nil
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	tx := fsys.begin()
+
+	inode, err := tx.readInode(ino)
+	if err != nil {
+		return err
+	}
+
+	inode.Atime = time.Now().UnixNano()
+	err = tx.writeInode(ino, inode)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
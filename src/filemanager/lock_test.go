@@ -0,0 +1,175 @@
+package filemanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Jonaires777/src/device"
+)
+
+// newConcurrentFS usa um arquivo de verdade como disco para que o fsck possa
+// verificar o resultado no fim.
+func newConcurrentFS(t *testing.T) (*FileSystem, string) {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "disk.img")
+	dev, err := device.CreateFileDevice(filename, 8<<20)
+	if err != nil {
+		t.Fatalf("CreateFileDevice: %v", err)
+	}
+
+	err = Format(dev, 1024, 64)
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+
+	fsys, err := MountDevice(dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+	return fsys, filename
+}
+
+func checkFsck(t *testing.T, fsys *FileSystem, filename string) {
+	t.Helper()
+
+	err := fsys.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	report, err := Fsck(filename, false)
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if len(report.Problems) > 0 {
+		t.Fatalf("fsck encontrou problemas: %v", report.Problems)
+	}
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	fsys, filename := newConcurrentFS(t)
+
+	// Poucos nomes para muitas goroutines, para que elas disputem os mesmos
+	// arquivos; as únicas falhas aceitas são as de arquivo que ainda não
+	// existe ou que já existe.
+	names := []string{"/a", "/b", "/c", "/d"}
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := rand.New(rand.NewSource(int64(g)))
+			for range 150 {
+				name := names[r.Intn(len(names))]
+
+				var err error
+				switch r.Intn(6) {
+				case 0:
+					err = fsys.CreateFile(name, 1+r.Intn(3000))
+				case 1:
+					err = fsys.RemoveFile(name)
+				case 2:
+					_, err = fsys.ReadFile(name, 0, 1)
+				case 3:
+					_, err = fsys.OrderFile(name, SortOptions{Memory: 3 * 1024, Workers: 2, Descending: r.Intn(2) == 0})
+				case 4:
+					_, _, err = fsys.FindValue(name, 42)
+				case 5:
+					_, _, err = fsys.ListFiles("/")
+				}
+				if err != nil && !errors.Is(err, ErrNotFound) && err.Error() != "arquivo já existe" {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Um arquivo marcado como ordenado precisa estar ordenado: a ordenação e
+	// a troca dos extents não podem ter se misturado com outra operação.
+	for _, name := range names {
+		inode, err := fsys.Lookup(name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Lookup(%s): %v", name, err)
+		}
+
+		values, err := fsys.ReadFile(name, 0, inode.Size/4)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", name, err)
+		}
+		if inode.Flags&FlagSortedAsc != 0 && !slices.IsSorted(values) {
+			t.Errorf("%s marcado como crescente fora de ordem", name)
+		}
+		if inode.Flags&FlagSortedDesc != 0 {
+			slices.Reverse(values)
+			if !slices.IsSorted(values) {
+				t.Errorf("%s marcado como decrescente fora de ordem", name)
+			}
+		}
+	}
+
+	checkFsck(t, fsys, filename)
+}
+
+func TestConcurrentFiles(t *testing.T) {
+	fsys, filename := newConcurrentFS(t)
+
+	// Cada goroutine grava e relê o seu próprio arquivo em pedaços; dois
+	// arquivos que recebessem o mesmo bloco teriam o conteúdo misturado.
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			name := fmt.Sprintf("/g%d", g)
+			for round := range 10 {
+				var data []byte
+				for i := range 500 + 100*round {
+					data = binary.LittleEndian.AppendUint32(data, uint32(g<<24|i))
+				}
+
+				f, err := fsys.Create(name)
+				if err != nil {
+					t.Errorf("Create(%s): %v", name, err)
+					return
+				}
+				for chunk := range slices.Chunk(data, 700) {
+					_, err = f.Write(chunk)
+					if err != nil {
+						t.Errorf("Write(%s): %v", name, err)
+						return
+					}
+				}
+				f.Close()
+
+				var out bytes.Buffer
+				_, err = fsys.Export(name, &out, FormatRaw)
+				if err != nil || !bytes.Equal(out.Bytes(), data) {
+					t.Errorf("%s relido com conteúdo diferente: %v", name, err)
+					return
+				}
+			}
+
+			err := fsys.RemoveFile(name)
+			if err != nil {
+				t.Errorf("RemoveFile(%s): %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	checkFsck(t, fsys, filename)
+}
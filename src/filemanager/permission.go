@@ -0,0 +1,118 @@
+package filemanager
+
+import (
+	"errors"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+var ErrPermission = errors.New("permissão negada")
+
+const (
+	permExec  = 1
+	permWrite = 2
+	permRead  = 4
+)
+
+// checkAccess aplica as regras do Unix: vale a classe do dono, senão a do
+// grupo, senão a dos outros. O root não passa por verificação.
+func (tx *transaction) checkAccess(inode *Inode, want uint32) error {
+	uid, gid := tx.fsys.uid, tx.fsys.gid
+	if uid == constants.RootUID {
+		return nil
+	}
+
+	mode := inode.Mode
+	switch {
+	case inode.UID == uid:
+		mode >>= 6
+	case inode.GID == gid:
+		mode >>= 3
+	}
+
+	if mode&want != want {
+		return ErrPermission
+	}
+	return nil
+}
+
+// checkDirWrite verifica se o usuário pode criar ou apagar entradas em dirIno.
+func (tx *transaction) checkDirWrite(dirIno int64) error {
+	dir, err := tx.readInode(dirIno)
+	if err != nil {
+		return err
+	}
+	return tx.checkAccess(&dir, permWrite|permExec)
+}
+
+// Chmod só é permitido ao dono do arquivo e ao root.
+func (fsys *FileSystem) Chmod(filename string, mode uint32) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if mode > 0777 {
+		return errors.New("modo inválido")
+	}
+
+	tx := fsys.begin()
+
+	ino, inode, err := tx.resolvePath(filename)
+	if err != nil {
+		return err
+	}
+
+	if fsys.uid != constants.RootUID && fsys.uid != inode.UID {
+		return ErrPermission
+	}
+
+	inode.Mode = mode
+	err = tx.writeInode(ino, inode)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+// Chown só é permitido ao root. Um group vazio mantém o grupo atual.
+func (fsys *FileSystem) Chown(filename, user, group string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if fsys.uid != constants.RootUID {
+		return ErrPermission
+	}
+
+	tx := fsys.begin()
+
+	accounts, err := tx.readAccounts()
+	if err != nil {
+		return err
+	}
+
+	ino, inode, err := tx.resolvePath(filename)
+	if err != nil {
+		return err
+	}
+
+	i, ok := findAccount(accounts, AccountUser, user)
+	if !ok {
+		return errors.New("usuário não encontrado")
+	}
+	inode.UID = accounts[i].ID
+
+	if group != "" {
+		i, ok := findAccount(accounts, AccountGroup, group)
+		if !ok {
+			return errors.New("grupo não encontrado")
+		}
+		inode.GID = accounts[i].ID
+	}
+
+	err = tx.writeInode(ino, inode)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
@@ -0,0 +1,204 @@
+package filemanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+func TestPermissions(t *testing.T) {
+	fsys := newTestFS(t)
+
+	for _, err := range []error{
+		fsys.AddUser("alice", "", "senha-alice", false),
+		fsys.AddUser("bob", "alice", "senha-bob", false),
+		fsys.MakeDirectory("/pub"),
+		fsys.Chmod("/pub", 0777),
+		fsys.CreateFile("/segredo", 10),
+		fsys.Chmod("/segredo", 0600),
+	} {
+		if err != nil {
+			t.Fatalf("preparação: %v", err)
+		}
+	}
+
+	err := fsys.Login("alice", "senha-alice")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	_, err = fsys.ReadFile("/segredo", 0, 1)
+	if !errors.Is(err, ErrPermission) {
+		t.Fatalf("leitura de arquivo 0600 de outro dono: %v", err)
+	}
+
+	err = fsys.CreateFile("/raiz", 1)
+	if !errors.Is(err, ErrPermission) {
+		t.Fatalf("criação na raiz do root: %v", err)
+	}
+
+	err = fsys.CreateFile("/pub/a", 10)
+	if err != nil {
+		t.Fatalf("CreateFile em diretório 0777: %v", err)
+	}
+
+	err = fsys.Chmod("/pub/a", 0640)
+	if err != nil {
+		t.Fatalf("Chmod pelo dono: %v", err)
+	}
+
+	err = fsys.Chown("/pub/a", "bob", "")
+	if !errors.Is(err, ErrPermission) {
+		t.Fatalf("chown por usuário comum: %v", err)
+	}
+
+	// bob está no grupo alice, que só tem leitura em /pub/a.
+	err = fsys.Login("bob", "senha-bob")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	_, err = fsys.ReadFile("/pub/a", 0, 1)
+	if err != nil {
+		t.Fatalf("leitura pelo grupo: %v", err)
+	}
+
+	_, err = fsys.OrderFile("/pub/a", SortOptions{Workers: 1})
+	if !errors.Is(err, ErrPermission) {
+		t.Fatalf("ordenação sem escrita: %v", err)
+	}
+
+	err = fsys.SetPassword("segredo", false)
+	if err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+
+	err = fsys.Login("bob", "errada")
+	if err == nil {
+		t.Fatal("login com senha errada deveria falhar")
+	}
+
+	err = fsys.Login("bob", "segredo")
+	if err != nil {
+		t.Fatalf("Login com senha: %v", err)
+	}
+
+	user, group := fsys.Whoami()
+	if user != "bob" || group != "alice" {
+		t.Fatalf("Whoami = %s, %s", user, group)
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	fsys := newTestFS(t)
+
+	// O root de um disco novo não tem senha e precisa definir uma.
+	err := fsys.Login("root", "")
+	if !errors.Is(err, ErrNoPassword) {
+		t.Fatalf("login como root sem senha: %v", err)
+	}
+	err = fsys.SetInitialPassword("root", "")
+	if !errors.Is(err, ErrEmptyPassword) {
+		t.Fatalf("senha inicial vazia: %v", err)
+	}
+	err = fsys.SetInitialPassword("root", "raiz")
+	if err != nil {
+		t.Fatalf("SetInitialPassword: %v", err)
+	}
+	err = fsys.SetInitialPassword("root", "outra")
+	if err == nil {
+		t.Fatal("a senha inicial só pode ser definida uma vez")
+	}
+	if fsys.Login("root", "") == nil || fsys.Login("root", "raiz") != nil {
+		t.Fatal("login do root não usa a senha definida")
+	}
+
+	err = fsys.AddUser("carol", "", "", false)
+	if !errors.Is(err, ErrEmptyPassword) {
+		t.Fatalf("usuário com senha vazia sem pedir: %v", err)
+	}
+
+	// Sem senha, só quando pedido explicitamente.
+	err = fsys.AddUser("dave", "", "", true)
+	if err != nil {
+		t.Fatalf("AddUser sem senha: %v", err)
+	}
+	err = fsys.Login("dave", "")
+	if err != nil {
+		t.Fatalf("login sem senha permitido: %v", err)
+	}
+
+	err = fsys.SetPassword("", false)
+	if !errors.Is(err, ErrEmptyPassword) {
+		t.Fatalf("remoção de senha sem pedir: %v", err)
+	}
+	err = fsys.SetPassword("nova", false)
+	if err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if fsys.Login("dave", "") == nil {
+		t.Fatal("login sem senha depois de definir uma")
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	// Vetores da RFC 7914, seção 11, truncados em 32 bytes.
+	tests := []struct {
+		password, salt string
+		iterations     uint32
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, test := range tests {
+		key := pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations)
+		if got := hex.EncodeToString(key[:]); got != test.want {
+			t.Errorf("pbkdf2(%s, %s, %d) = %s, esperado %s", test.password, test.salt, test.iterations, got, test.want)
+		}
+	}
+
+	fsys := newTestFS(t)
+	err := fsys.SetInitialPassword("root", "raiz")
+	if err != nil {
+		t.Fatalf("SetInitialPassword: %v", err)
+	}
+
+	// Usuário inexistente e senha errada dão o mesmo erro.
+	if err := fsys.Login("ninguem", "x"); !errors.Is(err, ErrLogin) {
+		t.Fatalf("login de usuário inexistente: %v", err)
+	}
+	if err := fsys.Login("root", "x"); !errors.Is(err, ErrLogin) {
+		t.Fatalf("login com senha errada: %v", err)
+	}
+
+	// Uma senha no formato antigo ainda entra e é regravada com PBKDF2.
+	tx := fsys.begin()
+	accounts, err := tx.readAccounts()
+	if err != nil {
+		t.Fatalf("readAccounts: %v", err)
+	}
+	i, _ := findAccount(accounts, AccountUser, "root")
+	accounts[i].Iterations = 0
+	accounts[i].Hash = sha256.Sum256(append(accounts[i].Salt[:], "antiga"...))
+	err = tx.saveAccounts(accounts)
+	if err != nil {
+		t.Fatalf("saveAccounts: %v", err)
+	}
+
+	err = fsys.Login("root", "antiga")
+	if err != nil {
+		t.Fatalf("login com senha no formato antigo: %v", err)
+	}
+	accounts, err = fsys.begin().readAccounts()
+	if err != nil {
+		t.Fatalf("readAccounts: %v", err)
+	}
+	i, _ = findAccount(accounts, AccountUser, "root")
+	if accounts[i].Iterations != constants.PasswordIterations || !accounts[i].checkPassword("antiga") {
+		t.Fatalf("senha não foi regravada no formato atual: %+v", accounts[i])
+	}
+}
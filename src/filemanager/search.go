@@ -0,0 +1,82 @@
+package filemanager
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// FindValue devolve os índices de todas as ocorrências de value no arquivo,
+// em ordem crescente. Em arquivos marcados como ordenados a primeira
+// ocorrência é achada por busca binária e as demais estão logo depois dela;
+// nos outros o arquivo é percorrido inteiro. O bool indica se a busca binária
+// foi usada.
+func (fsys *FileSystem) FindValue(filename string, value int32) ([]int64, bool, error) {
+	unlock, err := fsys.lockFiles(false, filename)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
+	ino, inode, err := fsys.openFile(filename, permRead)
+	if err != nil {
+		return nil, false, err
+	}
+
+	start := int64(0)
+	if inode.Sorted() {
+		start, err = fsys.searchFirst(&inode, value)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	indexes, err := fsys.scanValue(&inode, start, value, inode.Sorted())
+	if err != nil {
+		return nil, false, err
+	}
+
+	return indexes, inode.Sorted(), fsys.touch(ino)
+}
+
+// searchFirst acha o primeiro índice cujo valor não vem antes de value na
+// ordem do arquivo.
+func (fsys *FileSystem) searchFirst(inode *Inode, value int32) (int64, error) {
+	var err error
+	data := make([]byte, 4)
+	first := sort.Search(int(inode.Size/4), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		err = fsys.readData(inode, int64(i)*4, data)
+		current := int32(binary.LittleEndian.Uint32(data))
+		if inode.Flags&FlagSortedDesc != 0 {
+			return current <= value
+		}
+		return current >= value
+	})
+	return int64(first), err
+}
+
+// scanValue lê o arquivo um bloco por vez a partir do índice start. Com
+// sorted, para no primeiro valor diferente depois das ocorrências.
+func (fsys *FileSystem) scanValue(inode *Inode, start int64, value int32, sorted bool) ([]int64, error) {
+	var indexes []int64
+	count := inode.Size / 4
+	block := make([]byte, fsys.sb.BlockSize)
+	for pos := start; pos < count; {
+		chunk := block[:min(int64(len(block)), (count-pos)*4)]
+		err := fsys.readData(inode, pos*4, chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < len(chunk); i, pos = i+4, pos+1 {
+			if int32(binary.LittleEndian.Uint32(chunk[i:])) == value {
+				indexes = append(indexes, pos)
+			} else if sorted {
+				return indexes, nil
+			}
+		}
+	}
+	return indexes, nil
+}
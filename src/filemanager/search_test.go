@@ -0,0 +1,101 @@
+package filemanager
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFindValue(t *testing.T) {
+	fsys := newTestFS(t)
+
+	// 600 valores de -5 a 5, o bastante para ocupar vários blocos.
+	var text strings.Builder
+	var want []int64
+	for i := range 600 {
+		value := i*7%11 - 5
+		fmt.Fprintln(&text, value)
+		if value == 3 {
+			want = append(want, int64(i))
+		}
+	}
+	_, err := fsys.Import("/dados", strings.NewReader(text.String()), FormatText)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	indexes, binary, err := fsys.FindValue("/dados", 3)
+	if err != nil || binary {
+		t.Fatalf("FindValue sem ordenar: binary=%v, %v", binary, err)
+	}
+	if !slices.Equal(indexes, want) {
+		t.Fatalf("busca linear: %v, esperado %v", indexes, want)
+	}
+
+	for _, descending := range []bool{false, true} {
+		_, err = fsys.OrderFile("/dados", SortOptions{Memory: 3 * 1024, Descending: descending})
+		if err != nil {
+			t.Fatalf("OrderFile: %v", err)
+		}
+		values, err := fsys.ReadFile("/dados", 0, 600)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+
+		for _, value := range []int32{-6, -5, 0, 3, 5, 6} {
+			indexes, binary, err := fsys.FindValue("/dados", value)
+			if err != nil || !binary {
+				t.Fatalf("FindValue(%d) ordenado: binary=%v, %v", value, binary, err)
+			}
+			var want []int64
+			for i, v := range values {
+				if v == value {
+					want = append(want, int64(i))
+				}
+			}
+			if !slices.Equal(indexes, want) {
+				t.Fatalf("FindValue(%d), decrescente=%v: %v, esperado %v", value, descending, indexes, want)
+			}
+		}
+	}
+
+	// A marca sobrevive à remontagem e some com qualquer escrita.
+	err = fsys.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	remounted, err := MountDevice(fsys.dev)
+	if err != nil {
+		t.Fatalf("MountDevice: %v", err)
+	}
+	inode, err := remounted.Lookup("/dados")
+	if err != nil || inode.Flags != FlagSortedDesc {
+		t.Fatalf("marca de ordenação após remontar: %#x, %v", inode.Flags, err)
+	}
+
+	f, err := remounted.OpenFile("dados", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	_, err = f.WriteAt([]byte{0, 0, 0, 0}, 0)
+	if err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	f.Close()
+
+	_, binary, err = remounted.FindValue("/dados", 3)
+	if err != nil || binary {
+		t.Fatalf("arquivo alterado ainda usa busca binária: %v", err)
+	}
+
+	_, err = remounted.OrderFile("/dados", SortOptions{Key: KeyAbs})
+	if err != nil {
+		t.Fatalf("OrderFile: %v", err)
+	}
+	inode, _ = remounted.Lookup("/dados")
+	if inode.Sorted() {
+		t.Fatal("ordenar por chave derivada não deixa o arquivo ordenado por valor")
+	}
+}
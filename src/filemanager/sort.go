@@ -0,0 +1,574 @@
+package filemanager
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+// OrderFile ordena os inteiros do arquivo usando no máximo opts.Memory bytes
+// de buffers. opts.Algorithm, um dos SortAlgorithms, ordena cada run em
+// memória, em até opts.Workers goroutines. O resultado é gravado em blocos
+// novos e só passa a valer no commit, que troca os extents do arquivo: uma
+// queda no meio deixa o arquivo original intacto.
+func (fsys *FileSystem) OrderFile(filename string, opts SortOptions) (SortStats, error) {
+	if fsys.readOnly {
+		return SortStats{}, ErrReadOnly
+	}
+
+	if opts.Algorithm == "" {
+		opts.Algorithm = DefaultSortAlgorithm
+		if opts.Stable {
+			opts.Algorithm = "merge"
+		}
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	stats := SortStats{Algorithm: opts.Algorithm, Workers: opts.Workers}
+
+	sortValues, err := sortFunc(opts.Algorithm)
+	if err != nil {
+		return stats, err
+	}
+	if opts.Stable && !slices.Contains(StableAlgorithms, opts.Algorithm) {
+		return stats, fmt.Errorf("o algoritmo '%s' não é estável, use um de %v", opts.Algorithm, StableAlgorithms)
+	}
+
+	rank, err := rankFunc(opts)
+	if err != nil {
+		return stats, err
+	}
+
+	memory, err := fsys.sortMemory(opts.Memory)
+	if err != nil {
+		return stats, err
+	}
+
+	unlock, err := fsys.lockFiles(true, filename)
+	if err != nil {
+		return stats, err
+	}
+	defer unlock()
+
+	ino, inode, err := fsys.openFile(filename, permRead|permWrite)
+	if err != nil {
+		return stats, err
+	}
+
+	area, err := fsys.externalSort(&inode, memory, sortValues, rank, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, fsys.commitSort(ino, &area, opts)
+}
+
+// commitSort troca os extents do arquivo pelos da área com o resultado, que
+// deixa de estar reservada e passa a constar no bitmap.
+func (fsys *FileSystem) commitSort(ino int64, area *Inode, opts SortOptions) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	defer markExtents(fsys.reserved, area.Extents, false)
+
+	tx := fsys.begin()
+
+	inode, err := tx.readInode(ino)
+	if err != nil {
+		return err
+	}
+
+	bitmap, err := tx.readBitmap()
+	if err != nil {
+		return err
+	}
+
+	markExtents(bitmap, inode.Extents, false)
+	markExtents(bitmap, area.Extents, true)
+	inode.Extents = area.Extents
+	inode.Mtime = time.Now().UnixNano()
+	inode.Atime = inode.Mtime
+	inode.Flags &^= sortedFlags
+	if opts.Key == KeyValue && opts.Descending {
+		inode.Flags |= FlagSortedDesc
+	} else if opts.Key == KeyValue {
+		inode.Flags |= FlagSortedAsc
+	}
+
+	err = tx.writeInode(ino, inode)
+	if err != nil {
+		return err
+	}
+
+	err = tx.writeBitmap(bitmap)
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+func (fsys *FileSystem) sortMemory(memory int64) (int64, error) {
+	if memory <= 0 {
+		memory = constants.DefaultSortMemory
+	}
+	if minimum := 3 * fsys.sb.BlockSize; memory < minimum {
+		return 0, fmt.Errorf("memória insuficiente para ordenar: mínimo de %d bytes", minimum)
+	}
+	return memory, nil
+}
+
+// benchInsertionLimit é o maior tamanho de run, em inteiros, em que
+// BenchSort ainda executa o insertion sort, que é quadrático.
+const benchInsertionLimit = 1 << 16
+
+// BenchSort executa a ordenação externa do arquivo com cada um dos
+// SortAlgorithms, em ordem crescente. Os resultados vão para blocos que nunca
+// são confirmados, então o arquivo não muda; é como ordenar uma cópia dos
+// dados. Numa montagem só de leitura não há onde gravar as runs, então o
+// arquivo é ordenado só em memória e precisa caber nela.
+func (fsys *FileSystem) BenchSort(filename string, memory int64) ([]SortStats, error) {
+	memory, err := fsys.sortMemory(memory)
+	if err != nil {
+		return nil, err
+	}
+
+	rank, err := rankFunc(SortOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := fsys.lockFiles(false, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	_, inode, err := fsys.openFile(filename, permRead)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SortStats
+	for _, algorithm := range SortAlgorithms {
+		stats := SortStats{Algorithm: algorithm, Workers: 1}
+
+		runLen := min(inode.Size/4, memory/4)
+		if algorithm == "insertion" && runLen > benchInsertionLimit {
+			stats.Skipped = true
+			results = append(results, stats)
+			continue
+		}
+
+		if fsys.readOnly {
+			err = fsys.memorySort(&inode, memory, sortFuncs[algorithm], rank, &stats)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, stats)
+			continue
+		}
+
+		area, err := fsys.externalSort(&inode, memory, sortFuncs[algorithm], rank, &stats)
+		if err != nil {
+			return nil, err
+		}
+		fsys.releaseSortArea(&area)
+		results = append(results, stats)
+	}
+	return results, nil
+}
+
+// memorySort lê todos os inteiros do arquivo e os ordena de uma vez, sem
+// gravar nada. O buffer de leitura conta no limite de memória, como em
+// externalSort.
+func (fsys *FileSystem) memorySort(inode *Inode, memory int64, sortValues func([]int32, *sorter), rank func(int32) uint32, stats *SortStats) error {
+	startTime := time.Now()
+	defer func() { stats.Elapsed = time.Since(startTime) }()
+
+	count := inode.Size / 4
+	buffer := fsys.sortBuffer(memory)
+	if limit := memory - int64(len(buffer)); count*4 > limit {
+		return fmt.Errorf("montagem só de leitura: o arquivo precisa caber nos %d bytes de memória da ordenação", limit)
+	}
+
+	values := make([]int32, 0, count)
+	for pos := int64(0); pos < count*4; pos += int64(len(buffer)) {
+		chunk := buffer[:min(int64(len(buffer)), count*4-pos)]
+		err := fsys.readData(inode, pos, chunk)
+		if err != nil {
+			return err
+		}
+		stats.IOBytes += int64(len(chunk))
+		values = decodeInts(values, chunk)
+	}
+
+	sortStart := time.Now()
+	sortValues(values, &sorter{rank: rank, stats: stats})
+	stats.SortTime = time.Since(sortStart)
+	stats.WallSortTime = stats.SortTime
+	return nil
+}
+
+// sortRun é um trecho ordenado de uma área, em posições de inteiros.
+type sortRun struct {
+	start int64
+	end   int64
+}
+
+// externalSort gera runs ordenadas de até memory bytes em uma área temporária
+// e as intercala com um heap, em quantas passadas forem necessárias, até
+// sobrar uma só. rank define a ordem, como em rankFunc. Devolve a área com o
+// resultado, que continua reservada até commitSort ou releaseSortArea; a
+// outra área é liberada. O arquivo deve estar travado, mas mu não: as
+// áreas são reservadas e os dados lidos e gravados sem ele.
+func (fsys *FileSystem) externalSort(inode *Inode, memory int64, sortValues func([]int32, *sorter), rank func(int32) uint32, stats *SortStats) (result Inode, err error) {
+	startTime := time.Now()
+	defer func() { stats.Elapsed = time.Since(startTime) }()
+
+	blockSize := fsys.sb.BlockSize
+	count := inode.Size / 4
+
+	src, err := fsys.reserveSortArea(inode.Size)
+	if err != nil {
+		return Inode{}, err
+	}
+
+	var dst Inode
+	defer func() {
+		fsys.releaseSortArea(&dst)
+		if err != nil {
+			fsys.releaseSortArea(&src)
+		}
+	}()
+
+	// O buffer de leitura e gravação sai da memória e o resto é dividido
+	// entre os workers. Arquivos que cabem nela são divididos em partes
+	// iguais para que todos os workers tenham trabalho.
+	buffer := fsys.sortBuffer(memory)
+	runMemory := memory - int64(len(buffer))
+	workers := int(max(min(int64(stats.Workers), runMemory/blockSize), 1))
+	runBlocks := min(runMemory/int64(workers)/blockSize, ceilDiv(ceilDiv(count*4, int64(workers)), blockSize))
+	runLen := max(runBlocks, 1) * blockSize / 4
+
+	runs, err := fsys.writeRuns(inode, &src, count, runLen, workers, buffer, sortValues, rank, stats)
+	if err != nil {
+		return Inode{}, err
+	}
+
+	if len(runs) > 1 {
+		dst, err = fsys.reserveSortArea(inode.Size)
+		if err != nil {
+			return Inode{}, err
+		}
+
+		// Cada run aberta usa um bloco de buffer, e mais um fica para a saída.
+		fanIn := int(memory/blockSize) - 1
+		for len(runs) > 1 {
+			runs, err = fsys.mergePass(&src, &dst, runs, fanIn, &sorter{rank: rank, stats: stats})
+			if err != nil {
+				return Inode{}, err
+			}
+			src, dst = dst, src
+		}
+	}
+
+	// Bytes que não formam um inteiro completo ficam no fim, como estavam.
+	if tail := inode.Size % 4; tail > 0 {
+		data := make([]byte, tail)
+		err = fsys.readData(inode, count*4, data)
+		if err != nil {
+			return Inode{}, err
+		}
+		err = fsys.writeData(&src, count*4, data)
+		if err != nil {
+			return Inode{}, err
+		}
+		stats.IOBytes += 2 * tail
+	}
+
+	return src, nil
+}
+
+// reserveSortArea separa blocos para uma área temporária. Eles não entram no
+// bitmap, só em fsys.reserved, então ficam fora do alcance do alocador sem
+// que nada precise ser desfeito se a ordenação falhar.
+func (fsys *FileSystem) reserveSortArea(size int64) (Inode, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	bitmap, err := fsys.begin().readBitmap()
+	if err != nil {
+		return Inode{}, err
+	}
+
+	extents, err := fsys.allocateExtents(bitmap, fsys.blocksForSize(size))
+	if err != nil {
+		return Inode{}, fmt.Errorf("sem espaço temporário para a ordenação: %w", err)
+	}
+	markExtents(fsys.reserved, extents, true)
+	return Inode{Size: size, Extents: extents}, nil
+}
+
+func (fsys *FileSystem) releaseSortArea(area *Inode) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	markExtents(fsys.reserved, area.Extents, false)
+}
+
+// sortJob é uma run lida do disco à espera de um worker. Cada job tem as
+// suas próprias estatísticas, somadas depois, para que os workers não
+// disputem os contadores.
+type sortJob struct {
+	start   int64
+	values  []int32
+	stats   SortStats
+	elapsed time.Duration
+}
+
+// sortBuffer devolve o buffer de leitura e gravação das runs, que conta no
+// limite de memória: fica com no máximo metade dele, sem passar de
+// constants.IOBufferSize, e com pelo menos um bloco.
+func (fsys *FileSystem) sortBuffer(memory int64) []byte {
+	blocks := max(min(constants.IOBufferSize, memory/2)/fsys.sb.BlockSize, 1)
+	return make([]byte, blocks*fsys.sb.BlockSize)
+}
+
+// writeRuns ordena em memória trechos de runLen inteiros de inode e os grava
+// nas mesmas posições de area. As runs são lidas em lotes de uma por worker;
+// só a ordenação é concorrente, a leitura e a gravação ficam nesta goroutine
+// e passam todas por buffer.
+func (fsys *FileSystem) writeRuns(inode, area *Inode, count, runLen int64, workers int, buffer []byte, sortValues func([]int32, *sorter), rank func(int32) uint32, stats *SortStats) ([]sortRun, error) {
+	var wg sync.WaitGroup
+	jobs := make(chan *sortJob)
+	defer close(jobs)
+
+	for range workers {
+		go func() {
+			for job := range jobs {
+				startTime := time.Now()
+				sortValues(job.values, &sorter{rank: rank, stats: &job.stats})
+				job.elapsed = time.Since(startTime)
+				wg.Done()
+			}
+		}()
+	}
+
+	batch := make([]*sortJob, workers)
+	for i := range batch {
+		batch[i] = &sortJob{values: make([]int32, 0, min(runLen, count))}
+	}
+
+	var runs []sortRun
+	for start := int64(0); start < count; {
+		n := 0
+		for ; n < workers && start < count; n++ {
+			end := min(start+runLen, count)
+
+			job := batch[n]
+			job.start = start
+			job.values = job.values[:0]
+			job.stats = SortStats{}
+			for pos := start * 4; pos < end*4; pos += int64(len(buffer)) {
+				chunk := buffer[:min(int64(len(buffer)), end*4-pos)]
+				err := fsys.readData(inode, pos, chunk)
+				if err != nil {
+					return nil, err
+				}
+				stats.IOBytes += int64(len(chunk))
+				job.values = decodeInts(job.values, chunk)
+			}
+
+			runs = append(runs, sortRun{start: start, end: end})
+			start = end
+		}
+
+		startTime := time.Now()
+		wg.Add(n)
+		for _, job := range batch[:n] {
+			jobs <- job
+		}
+		wg.Wait()
+		stats.WallSortTime += time.Since(startTime)
+
+		for _, job := range batch[:n] {
+			stats.Comparisons += job.stats.Comparisons
+			stats.Swaps += job.stats.Swaps
+			stats.SortTime += job.elapsed
+
+			pos := job.start * 4
+			for values := job.values; len(values) > 0; {
+				n := min(len(values), len(buffer)/4)
+				chunk := encodeInts(buffer[:0], values[:n])
+				err := fsys.writeData(area, pos, chunk)
+				if err != nil {
+					return nil, err
+				}
+				stats.IOBytes += int64(len(chunk))
+				pos += int64(len(chunk))
+				values = values[n:]
+			}
+		}
+	}
+	return runs, nil
+}
+
+// mergePass intercala grupos de até fanIn runs de src em dst. As runs são
+// contíguas, então cada grupo ocupa em dst as mesmas posições que em src.
+func (fsys *FileSystem) mergePass(src, dst *Inode, runs []sortRun, fanIn int, s *sorter) ([]sortRun, error) {
+	var merged []sortRun
+	for i := 0; i < len(runs); i += fanIn {
+		group := runs[i:min(i+fanIn, len(runs))]
+
+		err := fsys.mergeRuns(src, dst, group, s)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, sortRun{start: group[0].start, end: group[len(group)-1].end})
+	}
+	return merged, nil
+}
+
+func (fsys *FileSystem) mergeRuns(src, dst *Inode, runs []sortRun, s *sorter) error {
+	readers := make([]*runReader, len(runs))
+	h := &mergeHeap{sorter: s}
+	for i, r := range runs {
+		readers[i] = fsys.newRunReader(src, r, s.stats)
+		value, ok, err := readers[i].next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Push(h, mergeItem{value: value, run: i})
+		}
+	}
+
+	writer := fsys.newRunWriter(dst, runs[0].start, s.stats)
+	for h.Len() > 0 {
+		item := h.items[0]
+		err := writer.write(item.value)
+		if err != nil {
+			return err
+		}
+
+		value, ok, err := readers[item.run].next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.items[0].value = value
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return writer.flush()
+}
+
+// runReader lê uma run um bloco por vez.
+type runReader struct {
+	fsys     *FileSystem
+	stats    *SortStats
+	area     *Inode
+	pos      int64
+	end      int64
+	block    []byte
+	buffered []byte
+}
+
+func (fsys *FileSystem) newRunReader(area *Inode, r sortRun, stats *SortStats) *runReader {
+	return &runReader{fsys: fsys, stats: stats, area: area, pos: r.start, end: r.end, block: make([]byte, fsys.sb.BlockSize)}
+}
+
+func (reader *runReader) next() (int32, bool, error) {
+	if len(reader.buffered) == 0 {
+		if reader.pos == reader.end {
+			return 0, false, nil
+		}
+
+		n := min(int64(len(reader.block))/4, reader.end-reader.pos)
+		reader.buffered = reader.block[:n*4]
+		err := reader.fsys.readData(reader.area, reader.pos*4, reader.buffered)
+		if err != nil {
+			return 0, false, err
+		}
+		reader.stats.IOBytes += n * 4
+		reader.pos += n
+	}
+
+	value := int32(binary.LittleEndian.Uint32(reader.buffered))
+	reader.buffered = reader.buffered[4:]
+	return value, true, nil
+}
+
+// runWriter acumula inteiros em um bloco e o grava quando fica cheio.
+type runWriter struct {
+	fsys  *FileSystem
+	stats *SortStats
+	area  *Inode
+	pos   int64
+	block []byte
+	fill  int
+}
+
+func (fsys *FileSystem) newRunWriter(area *Inode, start int64, stats *SortStats) *runWriter {
+	return &runWriter{fsys: fsys, stats: stats, area: area, pos: start * 4, block: make([]byte, fsys.sb.BlockSize)}
+}
+
+func (writer *runWriter) write(value int32) error {
+	binary.LittleEndian.PutUint32(writer.block[writer.fill:], uint32(value))
+	writer.fill += 4
+	if writer.fill == len(writer.block) {
+		return writer.flush()
+	}
+	return nil
+}
+
+func (writer *runWriter) flush() error {
+	if writer.fill == 0 {
+		return nil
+	}
+	err := writer.fsys.writeData(writer.area, writer.pos, writer.block[:writer.fill])
+	if err != nil {
+		return err
+	}
+	writer.pos += int64(writer.fill)
+	writer.stats.IOBytes += int64(writer.fill)
+	writer.fill = 0
+	return nil
+}
+
+type mergeItem struct {
+	value int32
+	run   int
+}
+
+// mergeHeap conta as suas comparações junto com as da ordenação das runs.
+// Em chaves iguais vence a run anterior, o que mantém a intercalação estável.
+type mergeHeap struct {
+	items  []mergeItem
+	sorter *sorter
+}
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	h.sorter.stats.Comparisons++
+	rankA, rankB := h.sorter.rank(a.value), h.sorter.rank(b.value)
+	return rankA < rankB || rankA == rankB && a.run < b.run
+}
+
+func (h *mergeHeap) Len() int      { return len(h.items) }
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x any)    { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
@@ -0,0 +1,147 @@
+package filemanager
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestOrderFileExternal(t *testing.T) {
+	fsys := newTestFS(t)
+
+	// 5000 inteiros e mais 3 bytes soltos no fim, que devem ser preservados.
+	values := make([]int32, 5000)
+	data := make([]byte, 0, len(values)*4+3)
+	for i := range values {
+		values[i] = rand.Int31() - 1<<30
+		data = binary.LittleEndian.AppendUint32(data, uint32(values[i]))
+	}
+	data = append(data, 7, 8, 9)
+
+	_, err := fsys.Import("/dados", bytes.NewReader(data), FormatRaw)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	before := usedBlocks(fsys)
+
+	_, err = fsys.OrderFile("/dados", SortOptions{Memory: 2 * 1024, Workers: 1})
+	if err == nil {
+		t.Fatal("OrderFile com menos de 3 blocos de memória deveria falhar")
+	}
+
+	// 3 blocos de 1024 bytes: um vai para o buffer de leitura, então as runs
+	// têm 512 inteiros e são intercaladas duas a duas, em várias passadas.
+	_, err = fsys.OrderFile("/dados", SortOptions{Memory: 3 * 1024, Workers: 1})
+	if err != nil {
+		t.Fatalf("OrderFile: %v", err)
+	}
+
+	got, err := fsys.ReadFile("/dados", 0, int64(len(values)))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	slices.Sort(values)
+	if !slices.Equal(got, values) {
+		t.Fatal("arquivo não ficou ordenado")
+	}
+
+	var out bytes.Buffer
+	_, err = fsys.Export("/dados", &out, FormatRaw)
+	if err != nil || !bytes.HasSuffix(out.Bytes(), []byte{7, 8, 9}) {
+		t.Fatalf("bytes finais não foram preservados: %v", err)
+	}
+
+	if used := usedBlocks(fsys); used != before {
+		t.Fatalf("blocos em uso após ordenar: %d, antes %d", used, before)
+	}
+}
+
+func TestOrderFileParallel(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("/dados", 20000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	values, err := fsys.ReadFile("/dados", 0, 20000)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	// 8 blocos divididos entre 4 workers: runs de 2 blocos, em lotes de 4.
+	stats, err := fsys.OrderFile("/dados", SortOptions{Memory: 8 * 1024, Algorithm: "merge", Workers: 4})
+	if err != nil {
+		t.Fatalf("OrderFile: %v", err)
+	}
+	if stats.Workers != 4 || stats.SortTime == 0 || stats.WallSortTime == 0 {
+		t.Fatalf("estatísticas inesperadas: %+v", stats)
+	}
+
+	got, err := fsys.ReadFile("/dados", 0, 20000)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	slices.Sort(values)
+	if !slices.Equal(got, values) {
+		t.Fatal("arquivo não ficou ordenado")
+	}
+}
+
+func TestOrderFileStable(t *testing.T) {
+	fsys := newTestFS(t)
+
+	err := fsys.CreateFile("/dados", 3000)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	values, err := fsys.ReadFile("/dados", 0, 3000)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	_, err = fsys.OrderFile("/dados", SortOptions{Algorithm: "quick", Stable: true})
+	if err == nil {
+		t.Fatal("quick não é estável e deveria ser recusado")
+	}
+
+	// Com 3 blocos de memória há várias runs e passadas de intercalação, que
+	// também precisam manter a ordem das chaves iguais.
+	opts := SortOptions{Memory: 3 * 1024, Workers: 2, Key: KeyModulo, Modulus: 10, Descending: true, Stable: true}
+	stats, err := fsys.OrderFile("/dados", opts)
+	if err != nil {
+		t.Fatalf("OrderFile: %v", err)
+	}
+	if stats.Algorithm != "merge" {
+		t.Fatalf("algoritmo estável padrão: %s", stats.Algorithm)
+	}
+
+	got, err := fsys.ReadFile("/dados", 0, 3000)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	slices.SortStableFunc(values, func(a, b int32) int {
+		return cmp.Compare((b%10+10)%10, (a%10+10)%10)
+	})
+	if !slices.Equal(got, values) {
+		t.Fatal("ordenação estável por módulo não preservou a ordem original")
+	}
+}
+
+func TestSortBufferWithinMemory(t *testing.T) {
+	fsys := newTestFS(t)
+	blockSize := fsys.sb.BlockSize
+
+	for _, memory := range []int64{3 * blockSize, 4*blockSize + 100, 1024 * 1024, 16 * 1024 * 1024} {
+		buffer := int64(len(fsys.sortBuffer(memory)))
+		if buffer == 0 || buffer%blockSize != 0 {
+			t.Fatalf("memória %d: buffer de %d bytes não é um número inteiro de blocos", memory, buffer)
+		}
+		// sobra ao menos um bloco para as runs
+		if memory-buffer < blockSize {
+			t.Fatalf("memória %d: buffer de %d bytes não deixa espaço para as runs", memory, buffer)
+		}
+	}
+}
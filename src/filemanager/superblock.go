@@ -0,0 +1,222 @@
+package filemanager
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+type SuperBlock struct {
+	Version         uint32
+	CreatedAt       int64 // segundos desde a época Unix
+	UUID            [16]byte
+	DiskSize        int64
+	MaxInodes       int64
+	NumBlocks       int64
+	InodeTableStart int64
+	DataStart       int64
+	JournalStart    int64
+	BlockSize       int64
+	InodeSize       int64
+	BitmapStart     int64
+	JournalBlocks   int64
+	AccountsInode   int64 // inode da tabela de usuários e grupos
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// NewSuperBlock calcula o layout de um disco a partir do tamanho, do tamanho
+// de bloco e da quantidade de inodes. Cada região começa em um limite de bloco.
+func NewSuperBlock(diskSize, blockSize, maxInodes int64) (SuperBlock, error) {
+	if blockSize < constants.MinBlockSize || blockSize > constants.MaxBlockSize || blockSize&(blockSize-1) != 0 {
+		return SuperBlock{}, errors.New("tamanho de bloco deve ser potência de 2 entre 512 e 65536")
+	}
+	if maxInodes < 1 {
+		return SuperBlock{}, errors.New("quantidade de inodes deve ser positiva")
+	}
+	if diskSize < blockSize {
+		return SuperBlock{}, errors.New("disco pequeno demais para a geometria")
+	}
+	// Checado antes de multiplicar, para que o tamanho da tabela não estoure.
+	if maxInodes > (diskSize-blockSize)/constants.InodeSize {
+		return SuperBlock{}, errors.New("quantidade de inodes não cabe no disco")
+	}
+
+	sb := SuperBlock{
+		Version:   constants.LayoutVersion,
+		CreatedAt: time.Now().Unix(),
+		DiskSize:  diskSize,
+		MaxInodes: maxInodes,
+		NumBlocks: diskSize / blockSize,
+		BlockSize: blockSize,
+		InodeSize: constants.InodeSize,
+	}
+
+	if sb.NumBlocks > math.MaxUint32 {
+		return SuperBlock{}, errors.New("quantidade de blocos excede o endereçamento dos extents")
+	}
+
+	// O cabeçalho do journal precisa listar todos os blocos registrados.
+	sb.JournalBlocks = min(constants.DefaultJournalBlocks, 1+(blockSize-journalHeaderSize)/8)
+
+	sb.BitmapStart = blockSize
+	sb.InodeTableStart = sb.BitmapStart + ceilDiv(sb.BitmapSize(), blockSize)*blockSize
+	sb.JournalStart = sb.InodeTableStart + ceilDiv(maxInodes*constants.InodeSize, blockSize)*blockSize
+	sb.DataStart = sb.JournalStart + sb.JournalBlocks*blockSize
+
+	if sb.DataStart/blockSize >= sb.NumBlocks {
+		return SuperBlock{}, errors.New("disco pequeno demais para a geometria")
+	}
+
+	// UUID aleatório (versão 4, variante RFC 4122).
+	_, err := rand.Read(sb.UUID[:])
+	if err != nil {
+		return SuperBlock{}, err
+	}
+	sb.UUID[6] = sb.UUID[6]&0x0f | 0x40
+	sb.UUID[8] = sb.UUID[8]&0x3f | 0x80
+
+	return sb, nil
+}
+
+func (sb *SuperBlock) UUIDString() string {
+	u := sb.UUID
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+func (sb *SuperBlock) BitmapSize() int64 {
+	return ceilDiv(sb.NumBlocks, 8)
+}
+
+func (sb *SuperBlock) firstDataBlock() int64 {
+	return sb.DataStart / sb.BlockSize
+}
+
+func (sb *SuperBlock) inodeOffset(ino int64) int64 {
+	return sb.InodeTableStart + ino*sb.InodeSize
+}
+
+func (sb *SuperBlock) journalBlock(index int64) int64 {
+	return sb.JournalStart/sb.BlockSize + index
+}
+
+func (sb *SuperBlock) maxJournalEntries() int {
+	return int(sb.JournalBlocks - 1)
+}
+
+// validate confere se os campos derivados batem com a geometria declarada.
+func (sb *SuperBlock) validate() error {
+	expected, err := sb.rebuild()
+	if err != nil {
+		return err
+	}
+	if *sb != expected {
+		return errors.New("superbloco inconsistente")
+	}
+	return nil
+}
+
+// rebuild recalcula o layout a partir da geometria declarada, mantendo a
+// identidade (versão, criação e UUID) do disco.
+func (sb *SuperBlock) rebuild() (SuperBlock, error) {
+	expected, err := NewSuperBlock(sb.DiskSize, sb.BlockSize, sb.MaxInodes)
+	if err != nil {
+		return SuperBlock{}, err
+	}
+	expected.Version = sb.Version
+	expected.CreatedAt = sb.CreatedAt
+	expected.UUID = sb.UUID
+	expected.AccountsInode = sb.AccountsInode
+	return expected, nil
+}
+
+func serializeSuperblock(superblock SuperBlock) []byte {
+	data := make([]byte, constants.SuperBlockSize)
+	copy(data[0:8], constants.SuperBlockMagic)
+	binary.LittleEndian.PutUint32(data[8:12], superblock.Version)
+	binary.LittleEndian.PutUint64(data[16:24], uint64(superblock.CreatedAt))
+	copy(data[24:40], superblock.UUID[:])
+	binary.LittleEndian.PutUint64(data[40:48], uint64(superblock.DiskSize))
+	binary.LittleEndian.PutUint64(data[48:56], uint64(superblock.MaxInodes))
+	binary.LittleEndian.PutUint64(data[56:64], uint64(superblock.NumBlocks))
+	binary.LittleEndian.PutUint64(data[64:72], uint64(superblock.InodeTableStart))
+	binary.LittleEndian.PutUint64(data[72:80], uint64(superblock.DataStart))
+	binary.LittleEndian.PutUint64(data[80:88], uint64(superblock.JournalStart))
+	binary.LittleEndian.PutUint64(data[88:96], uint64(superblock.BlockSize))
+	binary.LittleEndian.PutUint64(data[96:104], uint64(superblock.InodeSize))
+	binary.LittleEndian.PutUint64(data[104:112], uint64(superblock.BitmapStart))
+	binary.LittleEndian.PutUint64(data[112:120], uint64(superblock.JournalBlocks))
+	binary.LittleEndian.PutUint64(data[120:128], uint64(superblock.AccountsInode))
+	return data
+}
+
+func deserializeSuperblock(data []byte) SuperBlock {
+	sb := SuperBlock{
+		Version:         binary.LittleEndian.Uint32(data[8:12]),
+		CreatedAt:       int64(binary.LittleEndian.Uint64(data[16:24])),
+		DiskSize:        int64(binary.LittleEndian.Uint64(data[40:48])),
+		MaxInodes:       int64(binary.LittleEndian.Uint64(data[48:56])),
+		NumBlocks:       int64(binary.LittleEndian.Uint64(data[56:64])),
+		InodeTableStart: int64(binary.LittleEndian.Uint64(data[64:72])),
+		DataStart:       int64(binary.LittleEndian.Uint64(data[72:80])),
+		JournalStart:    int64(binary.LittleEndian.Uint64(data[80:88])),
+		BlockSize:       int64(binary.LittleEndian.Uint64(data[88:96])),
+		InodeSize:       int64(binary.LittleEndian.Uint64(data[96:104])),
+		BitmapStart:     int64(binary.LittleEndian.Uint64(data[104:112])),
+		JournalBlocks:   int64(binary.LittleEndian.Uint64(data[112:120])),
+		AccountsInode:   int64(binary.LittleEndian.Uint64(data[120:128])),
+	}
+	copy(sb.UUID[:], data[24:40])
+	return sb
+}
+
+// readSuperblock lê o primeiro bloco com o menor tamanho de bloco aceito,
+// já que a geometria real só é conhecida depois desta leitura. Imagens sem a
+// assinatura jwfs ou de outra versão de layout são recusadas.
+func readSuperblock(dev device.BlockDevice) (SuperBlock, error) {
+	if dev.Size() < constants.MinBlockSize {
+		return SuperBlock{}, errors.New("imagem truncada: menor que um bloco")
+	}
+
+	data := make([]byte, constants.MinBlockSize)
+	err := dev.ReadBlock(constants.SuperBlockStart, data)
+	if err != nil {
+		return SuperBlock{}, err
+	}
+
+	if string(data[0:8]) != constants.SuperBlockMagic {
+		if isLegacySuperblock(data) {
+			return SuperBlock{}, errors.New("imagem no layout 1, execute 'upgrade' para convertê-la")
+		}
+		return SuperBlock{}, errors.New("imagem não é um disco jwfs: assinatura do superbloco ausente")
+	}
+
+	sb := deserializeSuperblock(data)
+	if sb.Version < constants.LayoutVersion {
+		return SuperBlock{}, fmt.Errorf("imagem no layout %d, execute 'upgrade' para convertê-la", sb.Version)
+	}
+	if sb.Version != constants.LayoutVersion {
+		return SuperBlock{}, fmt.Errorf("versão de layout %d incompatível, esperada %d", sb.Version, constants.LayoutVersion)
+	}
+
+	return sb, nil
+}
+
+func ReadSuperblock(filename string) (SuperBlock, error) {
+	dev, err := device.OpenFileDevice(filename, os.O_RDONLY)
+	if err != nil {
+		return SuperBlock{}, err
+	}
+	defer dev.Close()
+
+	return readSuperblock(dev)
+}
@@ -0,0 +1,177 @@
+package filemanager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Jonaires777/src/constants"
+)
+
+// TransferFormat define como o conteúdo é representado fora do disco: bytes
+// crus ou um inteiro de 32 bits por linha, em texto.
+type TransferFormat int
+
+const (
+	FormatRaw TransferFormat = iota
+	FormatText
+)
+
+// Import cria filename com o conteúdo de r, gravado em pedaços do tamanho de
+// um bloco. Em caso de erro, o arquivo parcial é removido. Devolve o tamanho
+// do arquivo criado, em bytes.
+func (fsys *FileSystem) Import(filename string, r io.Reader, format TransferFormat) (int64, error) {
+	f, err := fsys.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, constants.DefaultFileMode)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	switch format {
+	case FormatRaw:
+		n, err = fsys.importRaw(f, r)
+	case FormatText:
+		n, err = fsys.importText(f, r)
+	default:
+		err = errors.New("formato de transferência inválido")
+	}
+
+	if err != nil {
+		f.Close()
+		fsys.RemoveFile(filename)
+		return 0, err
+	}
+	return n, f.Close()
+}
+
+func (fsys *FileSystem) importRaw(f *File, r io.Reader) (int64, error) {
+	var total int64
+	chunk := make([]byte, fsys.sb.BlockSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			_, werr := f.Write(chunk[:n])
+			if werr != nil {
+				return 0, werr
+			}
+			total += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return total, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// importText ignora linhas em branco; qualquer outra linha precisa conter um
+// inteiro que caiba em 32 bits.
+func (fsys *FileSystem) importText(f *File, r io.Reader) (int64, error) {
+	var total int64
+	chunk := make([]byte, 0, fsys.sb.BlockSize)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		value, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("linha %d: %q não é um inteiro de 32 bits", line, text)
+		}
+
+		chunk = binary.LittleEndian.AppendUint32(chunk, uint32(value))
+		if len(chunk) == cap(chunk) {
+			_, err = f.Write(chunk)
+			if err != nil {
+				return 0, err
+			}
+			total += int64(len(chunk))
+			chunk = chunk[:0]
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Write(chunk)
+	if err != nil {
+		return 0, err
+	}
+	return total + int64(len(chunk)), nil
+}
+
+// Export escreve o conteúdo de filename em w, lendo um bloco por vez. Devolve
+// o tamanho do arquivo exportado, em bytes.
+func (fsys *FileSystem) Export(filename string, w io.Writer, format TransferFormat) (int64, error) {
+	f, err := fsys.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	inode, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	switch format {
+	case FormatRaw:
+	case FormatText:
+		if inode.Size%4 != 0 {
+			return 0, errors.New("tamanho do arquivo não é múltiplo de 4 bytes, exporte no formato raw")
+		}
+	default:
+		return 0, errors.New("formato de transferência inválido")
+	}
+
+	var total int64
+	chunk := make([]byte, fsys.sb.BlockSize)
+	buffered := bufio.NewWriter(w)
+	for {
+		n, err := f.Read(chunk)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if format == FormatRaw {
+			_, err = w.Write(chunk[:n])
+		} else {
+			err = writeIntegers(buffered, chunk[:n])
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += int64(n)
+	}
+
+	return total, buffered.Flush()
+}
+
+// writeIntegers escreve um inteiro por linha. O tamanho do bloco é múltiplo
+// de 4, então nenhum inteiro fica dividido entre duas leituras.
+func writeIntegers(w *bufio.Writer, data []byte) error {
+	var line []byte
+	for i := 0; i+4 <= len(data); i += 4 {
+		line = strconv.AppendInt(line[:0], int64(int32(binary.LittleEndian.Uint32(data[i:]))), 10)
+		line = append(line, '\n')
+		_, err := w.Write(line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package filemanager
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImportExport(t *testing.T) {
+	fsys := newTestFS(t)
+
+	raw := bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7}, 501)
+	n, err := fsys.Import("/raw", bytes.NewReader(raw), FormatRaw)
+	if err != nil || n != int64(len(raw)) {
+		t.Fatalf("Import raw = %d, %v", n, err)
+	}
+
+	var out bytes.Buffer
+	_, err = fsys.Export("/raw", &out, FormatRaw)
+	if err != nil || !bytes.Equal(out.Bytes(), raw) {
+		t.Fatalf("Export raw devolveu %d bytes, %v", out.Len(), err)
+	}
+
+	// 3507 bytes não formam inteiros completos.
+	_, err = fsys.Export("/raw", &out, FormatText)
+	if err == nil {
+		t.Fatal("export em texto de tamanho não múltiplo de 4 deveria falhar")
+	}
+
+	var text strings.Builder
+	for i := range 600 {
+		text.WriteString(strings.Repeat(" ", i%3))
+		text.WriteString(string(rune('0' + i%10)))
+		if i%7 == 0 {
+			text.WriteString("\n")
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString("-2147483648\n2147483647")
+
+	n, err = fsys.Import("/numeros", strings.NewReader(text.String()), FormatText)
+	if err != nil || n != 602*4 {
+		t.Fatalf("Import text = %d, %v", n, err)
+	}
+
+	numbers, err := fsys.ReadFile("/numeros", 598, 602)
+	if err != nil || !slices.Equal(numbers, []int32{8, 9, -2147483648, 2147483647}) {
+		t.Fatalf("ReadFile = %v, %v", numbers, err)
+	}
+
+	out.Reset()
+	_, err = fsys.Export("/numeros", &out, FormatText)
+	if err != nil {
+		t.Fatalf("Export text: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 602 || lines[1] != "1" || lines[601] != "2147483647" {
+		t.Fatalf("export em texto inesperado: %d linhas", len(lines))
+	}
+
+	before := usedBlocks(fsys)
+	_, err = fsys.Import("/ruim", strings.NewReader("1\n2\nx\n"), FormatText)
+	if err == nil || !strings.Contains(err.Error(), "linha 3") {
+		t.Fatalf("Import de texto inválido: %v", err)
+	}
+	if _, err := fsys.Lookup("/ruim"); err == nil {
+		t.Fatal("arquivo parcial deveria ser removido")
+	}
+	if used := usedBlocks(fsys); used != before {
+		t.Fatalf("blocos vazaram no import com erro: %d, antes %d", used, before)
+	}
+
+	_, err = fsys.Import("/raw", bytes.NewReader(raw), FormatRaw)
+	if err == nil {
+		t.Fatal("import sobre arquivo existente deveria falhar")
+	}
+}
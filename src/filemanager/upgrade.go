@@ -0,0 +1,603 @@
+package filemanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+// Geometria fixa do layout 1, o formato original: superbloco de 40 bytes sem
+// assinatura, inodes de 64 bytes (nome, tamanho e StartBlock em bytes) e o
+// conteúdo de cada arquivo gravado de forma contígua a partir de StartBlock.
+const (
+	legacyDiskSize        = 1 * 1024 * 1024 * 1024
+	legacyBlockSize       = 4096
+	legacyMaxInodes       = 1024
+	legacyInodeSize       = 64
+	legacyInodeTableStart = 36864
+	legacyDataStart       = 102400
+)
+
+type UpgradeReport struct {
+	From    uint32
+	To      uint32
+	Actions []string
+}
+
+// migration converte uma imagem da versão from para from+1. Com dryRun, nada
+// é gravado e apenas as ações planejadas são devolvidas.
+type migration struct {
+	from        uint32
+	description string
+	apply       func(dev device.BlockDevice, dryRun bool) ([]string, error)
+}
+
+var migrations = []migration{
+	{1, "superbloco com assinatura, inodes de 256 bytes com extents, diretórios e journal", upgradeFromV1},
+	{2, "modo, dono e tempos de criação, modificação e acesso nos inodes", upgradeFromV2},
+	{3, "tabela de usuários e grupos", upgradeFromV3},
+	{4, "tamanho dos arquivos contado em bytes", upgradeFromV4},
+}
+
+func isLegacySuperblock(data []byte) bool {
+	fields := []int64{
+		legacyDiskSize,
+		legacyMaxInodes,
+		legacyDiskSize / legacyBlockSize,
+		legacyInodeTableStart,
+		legacyDataStart,
+	}
+	for i, value := range fields {
+		if int64(binary.LittleEndian.Uint64(data[i*8:i*8+8])) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func detectLayoutVersion(dev device.BlockDevice) (uint32, error) {
+	if dev.Size() < constants.MinBlockSize {
+		return 0, errors.New("imagem truncada: menor que um bloco")
+	}
+
+	data := make([]byte, constants.MinBlockSize)
+	err := dev.ReadBlock(constants.SuperBlockStart, data)
+	if err != nil {
+		return 0, err
+	}
+
+	if string(data[0:8]) == constants.SuperBlockMagic {
+		return deserializeSuperblock(data).Version, nil
+	}
+	if isLegacySuperblock(data) {
+		return 1, nil
+	}
+	return 0, errors.New("imagem não é um disco jwfs: assinatura do superbloco ausente")
+}
+
+// Upgrade converte a imagem, no próprio arquivo, para o layout mais recente,
+// aplicando em sequência as migrações a partir da versão detectada.
+func Upgrade(filename string, dryRun bool) (UpgradeReport, error) {
+	flag := os.O_RDWR
+	if dryRun {
+		flag = os.O_RDONLY
+	}
+
+	dev, err := device.OpenFileDevice(filename, flag)
+	if err != nil {
+		return UpgradeReport{}, err
+	}
+	defer dev.Close()
+
+	return upgrade(dev, dryRun)
+}
+
+func upgrade(dev device.BlockDevice, dryRun bool) (UpgradeReport, error) {
+	var report UpgradeReport
+
+	version, err := detectLayoutVersion(dev)
+	if err != nil {
+		return report, err
+	}
+	if version > constants.LayoutVersion {
+		return report, fmt.Errorf("versão de layout %d é mais nova que a suportada (%d)", version, constants.LayoutVersion)
+	}
+
+	report.From = version
+	report.To = version
+	for _, m := range migrations {
+		if m.from != report.To {
+			continue
+		}
+
+		// Em uma simulação, os passos seguintes ao primeiro dependeriam de
+		// gravações que não aconteceram; eles são apenas descritos.
+		if dryRun && report.To != report.From {
+			report.Actions = append(report.Actions, fmt.Sprintf("versão %d para %d: %s", m.from, m.from+1, m.description))
+		} else {
+			actions, err := m.apply(dev, dryRun)
+			if err != nil {
+				return report, fmt.Errorf("migração da versão %d: %w", m.from, err)
+			}
+			report.Actions = append(report.Actions, actions...)
+		}
+		report.To = m.from + 1
+	}
+
+	if dryRun || report.To == report.From {
+		return report, nil
+	}
+	return report, dev.Sync()
+}
+
+type legacyFile struct {
+	name   string
+	size   int64
+	extent Extent
+}
+
+func readLegacyFiles(dev device.BlockDevice) ([]legacyFile, []string, error) {
+	table := make([]byte, legacyMaxInodes*legacyInodeSize)
+	err := readBytes(dev, legacyBlockSize, table, legacyInodeTableStart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []legacyFile
+	var actions []string
+	for i := int64(0); i < legacyMaxInodes; i++ {
+		data := table[i*legacyInodeSize : (i+1)*legacyInodeSize]
+		size := int64(binary.LittleEndian.Uint64(data[32:40]))
+		start := int64(binary.LittleEndian.Uint64(data[40:48]))
+		if size <= 0 {
+			continue
+		}
+
+		name := data[:32]
+		if end := bytes.IndexByte(name, 0); end >= 0 {
+			name = name[:end]
+		}
+
+		if start < legacyDataStart || start%legacyBlockSize != 0 ||
+			size > (legacyDiskSize-start)/4 {
+			actions = append(actions, fmt.Sprintf("inode %d (%q) descartado: dados fora do disco", i, name))
+			continue
+		}
+
+		files = append(files, legacyFile{
+			name:   string(name),
+			size:   size,
+			extent: Extent{Start: start / legacyBlockSize, Count: ceilDiv(size*4, legacyBlockSize)},
+		})
+	}
+	return files, actions, nil
+}
+
+// upgradeFromV1 reconstrói os metadados no layout 2 e coloca todos os
+// arquivos no diretório raiz. Arquivos cujos blocos caem na nova região de
+// metadados, ou que se sobrepõem a outro arquivo (o layout original permitia
+// isso), são copiados para blocos livres antes de qualquer metadado mudar.
+//
+// Os metadados novos ocupam o lugar da tabela de inodes antiga, então não
+// são gravados direto: eles vão como uma transação para um journal provisório
+// em blocos livres, e só então o superbloco troca de formato. Até essa troca
+// a imagem continua no layout 1; depois dela, uma migração interrompida é
+// retomada reaplicando a transação.
+func upgradeFromV1(dev device.BlockDevice, dryRun bool) ([]string, error) {
+	if dev.Size() < legacyDiskSize {
+		return nil, fmt.Errorf("imagem truncada: %d de %d bytes", dev.Size(), legacyDiskSize)
+	}
+
+	stage, staged, err := readStagedUpgrade(dev)
+	if err != nil {
+		return nil, err
+	}
+	if staged {
+		actions := []string{"migração interrompida retomada: metadados preparados no journal provisório reaplicados"}
+		if dryRun {
+			return actions, nil
+		}
+		return actions, finishUpgradeFromV1(dev, stage)
+	}
+
+	files, actions, err := readLegacyFiles(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	sb, err := NewSuperBlock(legacyDiskSize, legacyBlockSize, max(legacyMaxInodes, int64(len(files))+1))
+	if err != nil {
+		return nil, err
+	}
+	sb.Version = 2
+	fsys := &FileSystem{dev: dev, sb: sb}
+
+	bitmap := make([]byte, sb.BitmapSize())
+	for b := int64(0); b < sb.firstDataBlock(); b++ {
+		setBlock(bitmap, b, true)
+	}
+
+	inodes := make([]Inode, len(files))
+	var moves []int
+	for i, file := range files {
+		inodes[i] = Inode{Size: file.size, Type: TypeFile}
+
+		keep := file.extent.Start >= sb.firstDataBlock()
+		for b := file.extent.Start; keep && b < file.extent.Start+file.extent.Count; b++ {
+			keep = !blockAllocated(bitmap, b)
+		}
+
+		if keep {
+			inodes[i].Extents = []Extent{file.extent}
+			markExtents(bitmap, inodes[i].Extents, true)
+		} else {
+			moves = append(moves, i)
+		}
+	}
+
+	// Os blocos de origem das cópias ficam reservados até o fim do plano,
+	// para que nenhum destino sobrescreva dados ainda não copiados.
+	var sources []Extent
+	for _, i := range moves {
+		extent := files[i].extent
+		for b := max(extent.Start, sb.firstDataBlock()); b < extent.Start+extent.Count; b++ {
+			if !blockAllocated(bitmap, b) {
+				setBlock(bitmap, b, true)
+				sources = append(sources, Extent{Start: b, Count: 1})
+			}
+		}
+	}
+
+	for _, i := range moves {
+		inodes[i].Extents, err = fsys.allocateExtents(bitmap, files[i].extent.Count)
+		if err != nil {
+			return nil, fmt.Errorf("não há espaço para realocar %q: %w", files[i].name, err)
+		}
+		actions = append(actions, fmt.Sprintf("%q realocado dos blocos %d-%d para %v",
+			files[i].name, files[i].extent.Start, files[i].extent.Start+files[i].extent.Count-1, inodes[i].Extents))
+	}
+
+	taken := make(map[string]bool)
+	entries := make([]byte, int64(len(files))*constants.DirEntrySize)
+	for i, file := range files {
+		ino := int64(i) + 1
+		name := file.name
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") ||
+			len(name) >= constants.MaxFilenameLen || taken[name] {
+			name = uniqueName(strings.ReplaceAll(name, "/", "_"), ino, taken)
+			actions = append(actions, fmt.Sprintf("%q renomeado para %q", file.name, name))
+		}
+		taken[name] = true
+		copy(inodes[i].Filename[:], name)
+
+		var entry DirEntry
+		copy(entry.Name[:], name)
+		entry.Inode = ino
+		copy(entries[int64(i)*constants.DirEntrySize:], serializeDirEntry(entry))
+	}
+
+	root := Inode{Size: int64(len(files)), Type: TypeDir}
+	copy(root.Filename[:], "/")
+	root.Extents, err = fsys.allocateExtents(bitmap, ceilDiv(int64(len(entries)), sb.BlockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// O journal provisório precisa de blocos contíguos que não sejam de
+	// nenhum arquivo antigo; no layout novo eles voltam a ficar livres.
+	journal, err := fsys.allocateExtents(slices.Clone(bitmap), sb.JournalBlocks)
+	if err != nil || len(journal) != 1 {
+		return nil, fmt.Errorf("não há %d blocos livres contíguos para preparar a migração", sb.JournalBlocks)
+	}
+	stage = sb
+	stage.Version = 1
+	stage.JournalStart = journal[0].Start * sb.BlockSize
+
+	markExtents(bitmap, sources, false)
+
+	actions = append(actions, fmt.Sprintf("superbloco, bitmap e tabela de inodes reescritos no layout 2 (%d arquivos no diretório raiz)", len(files)))
+	if dryRun {
+		return actions, nil
+	}
+
+	block := make([]byte, sb.BlockSize)
+	for _, i := range moves {
+		for k := int64(0); k < files[i].extent.Count; k++ {
+			err := dev.ReadBlock(files[i].extent.Start+k, block)
+			if err != nil {
+				return nil, err
+			}
+			err = fsys.writeData(&inodes[i], k*sb.BlockSize, block)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = fsys.writeData(&root, 0, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bitmap, tabela de inodes e um journal vazio, lado a lado como no disco.
+	metadata := make([]byte, sb.JournalStart+sb.BlockSize-sb.BitmapStart)
+	copy(metadata, bitmap)
+	table := metadata[sb.InodeTableStart-sb.BitmapStart:]
+	copy(table, SerializeInode(root))
+	for i, inode := range inodes {
+		copy(table[(int64(i)+1)*sb.InodeSize:], SerializeInode(inode))
+	}
+	copy(metadata[sb.JournalStart-sb.BitmapStart:], serializeJournalHeader(&sb, journalHeader{}))
+
+	blocks := make(map[int64][]byte)
+	for off := int64(0); off < int64(len(metadata)); off += sb.BlockSize {
+		blocks[(sb.BitmapStart+off)/sb.BlockSize] = metadata[off : off+sb.BlockSize]
+	}
+	if len(blocks) > stage.maxJournalEntries() {
+		return nil, errors.New("metadados novos não cabem no journal")
+	}
+
+	_, err = writeJournal(dev, &stage, blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	err = InitializeSuperblock(dev, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dev.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, finishUpgradeFromV1(dev, stage)
+}
+
+// readStagedUpgrade reconhece uma migração do layout 1 interrompida depois da
+// troca do superbloco, que fica com a assinatura nova e a versão 1.
+func readStagedUpgrade(dev device.BlockDevice) (SuperBlock, bool, error) {
+	data := make([]byte, constants.MinBlockSize)
+	err := dev.ReadBlock(constants.SuperBlockStart, data)
+	if err != nil {
+		return SuperBlock{}, false, err
+	}
+	if string(data[0:8]) != constants.SuperBlockMagic {
+		return SuperBlock{}, false, nil
+	}
+	return deserializeSuperblock(data), true, nil
+}
+
+// finishUpgradeFromV1 aplica a transação do journal provisório e grava o
+// superbloco definitivo. Pode ser repetida se for interrompida.
+func finishUpgradeFromV1(dev device.BlockDevice, stage SuperBlock) error {
+	_, err := replayJournal(&FileSystem{dev: dev, sb: stage})
+	if err != nil {
+		return err
+	}
+
+	sb, err := stage.rebuild()
+	if err != nil {
+		return err
+	}
+	sb.Version = 2
+
+	err = InitializeSuperblock(dev, sb)
+	if err != nil {
+		return err
+	}
+	return dev.Sync()
+}
+
+// upgradeFromV2 preenche modo, dono e tempos dos inodes em uso, que no layout
+// 2 ficavam zerados. Na falta de informação melhor, os tempos passam a ser o
+// instante de criação do disco e o dono, o root.
+func upgradeFromV2(dev device.BlockDevice, dryRun bool) ([]string, error) {
+	fsys, actions, err := openForMigration(dev, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	sb := fsys.sb
+
+	table := make([]byte, sb.MaxInodes*sb.InodeSize)
+	err = fsys.readAt(table, sb.InodeTableStart)
+	if err != nil {
+		return nil, err
+	}
+
+	created := sb.CreatedAt * int64(time.Second)
+	converted := 0
+	for ino := int64(0); ino < sb.MaxInodes; ino++ {
+		raw := table[ino*sb.InodeSize : (ino+1)*sb.InodeSize]
+		inode := DeserializeInode(raw)
+		if inode.Type == TypeFree || inode.Mode != 0 {
+			continue
+		}
+
+		inode.Mode = constants.DefaultFileMode
+		if inode.IsDir() {
+			inode.Mode = constants.DefaultDirMode
+		}
+		inode.Ctime = created
+		inode.Mtime = created
+		inode.Atime = created
+		copy(raw, SerializeInode(inode))
+		converted++
+	}
+
+	actions = append(actions, fmt.Sprintf("modo, dono e tempos definidos em %d inodes", converted))
+	if dryRun {
+		return actions, nil
+	}
+
+	err = fsys.writeAt(table, sb.InodeTableStart)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dev.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	sb.Version = 3
+	return actions, InitializeSuperblock(dev, sb)
+}
+
+// openForMigration monta uma imagem a partir do layout 2 sem exigir a versão
+// atual, reaplicando antes uma transação pendente no journal. Como a
+// transação pode incluir o superbloco, ele é relido depois.
+func openForMigration(dev device.BlockDevice, dryRun bool) (*FileSystem, []string, error) {
+	data := make([]byte, constants.MinBlockSize)
+	err := dev.ReadBlock(constants.SuperBlockStart, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sb := deserializeSuperblock(data)
+	err = sb.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	fsys := &FileSystem{dev: dev, sb: sb}
+
+	var actions []string
+	header, err := readJournalHeader(dev, &sb)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(header.Blocks) > 0 {
+		actions = append(actions, fmt.Sprintf("journal com transação pendente (%d blocos) reaplicado antes da conversão", len(header.Blocks)))
+		if !dryRun {
+			_, err = replayJournal(fsys)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			err = dev.ReadBlock(constants.SuperBlockStart, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			fsys.sb = deserializeSuperblock(data)
+		}
+	}
+
+	err = fsys.loadMetadata()
+	if err != nil {
+		return nil, nil, err
+	}
+	return fsys, actions, nil
+}
+
+// upgradeFromV3 cria a tabela de contas com o usuário root. Uma tabela deixada
+// por uma migração interrompida é reaproveitada.
+func upgradeFromV3(dev device.BlockDevice, dryRun bool) ([]string, error) {
+	fsys, actions, err := openForMigration(dev, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := fsys.begin()
+
+	ino := int64(-1)
+	for i, inode := range fsys.inodes {
+		if inode.Type == TypeAccounts {
+			ino = int64(i)
+			break
+		}
+	}
+
+	create := ino < 0
+	if create {
+		ino, err = tx.findFreeInode()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	actions = append(actions, fmt.Sprintf("tabela de usuários e grupos criada no inode %d com o usuário root", ino))
+	if dryRun {
+		return actions, nil
+	}
+
+	fsys.sb.AccountsInode = ino
+	if create {
+		err = tx.createAccountsTable(ino)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.commit()
+		if err != nil {
+			return nil, err
+		}
+
+		err = fsys.Sync()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fsys.sb.Version = 4
+	return actions, InitializeSuperblock(dev, fsys.sb)
+}
+
+// upgradeFromV4 passa o tamanho dos arquivos de inteiros para bytes. Como a
+// conversão não pode ser aplicada duas vezes, os inodes e o superbloco com a
+// nova versão são gravados na mesma transação.
+func upgradeFromV4(dev device.BlockDevice, dryRun bool) ([]string, error) {
+	fsys, actions, err := openForMigration(dev, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	// a transação reaplicada do journal já era esta conversão
+	if fsys.sb.Version > 4 {
+		return actions, nil
+	}
+
+	tx := fsys.begin()
+
+	converted := 0
+	for ino := int64(0); ino < fsys.sb.MaxInodes; ino++ {
+		inode, err := tx.readInode(ino)
+		if err != nil {
+			return nil, err
+		}
+		if inode.Type != TypeFile {
+			continue
+		}
+
+		inode.Size *= 4
+		err = tx.writeInode(ino, inode)
+		if err != nil {
+			return nil, fmt.Errorf("tabela de inodes grande demais para converter em uma transação: %w", err)
+		}
+		converted++
+	}
+
+	actions = append(actions, fmt.Sprintf("tamanho de %d arquivos convertido para bytes", converted))
+	if dryRun {
+		return actions, nil
+	}
+
+	fsys.sb.Version = 5
+	_, err = tx.WriteAt(serializeSuperblock(fsys.sb), constants.SuperBlockStart)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.commit()
+	if err != nil {
+		return nil, err
+	}
+	return actions, fsys.Sync()
+}
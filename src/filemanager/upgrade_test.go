@@ -0,0 +1,280 @@
+package filemanager
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Jonaires777/src/constants"
+	"github.com/Jonaires777/src/device"
+)
+
+// writeLegacyImage grava uma imagem no layout 1 com os arquivos dados
+// (StartBlock em bytes, como no formato original) e devolve o conteúdo que
+// cada arquivo tem no disco, já considerando sobreposições.
+func writeLegacyImage(t *testing.T, filename string, names []string, starts, sizes []int64) [][]int32 {
+	t.Helper()
+
+	dev, err := device.CreateFileDevice(filename, legacyDiskSize)
+	if err != nil {
+		t.Fatalf("CreateFileDevice: %v", err)
+	}
+	defer dev.Close()
+
+	superblock := make([]byte, 40)
+	for i, value := range []int64{legacyDiskSize, legacyMaxInodes, legacyDiskSize / legacyBlockSize, legacyInodeTableStart, legacyDataStart} {
+		binary.LittleEndian.PutUint64(superblock[i*8:], uint64(value))
+	}
+	err = writeBytes(dev, legacyBlockSize, superblock, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range names {
+		inode := make([]byte, legacyInodeSize)
+		copy(inode, names[i])
+		binary.LittleEndian.PutUint64(inode[32:40], uint64(sizes[i]))
+		binary.LittleEndian.PutUint64(inode[40:48], uint64(starts[i]))
+		err = writeBytes(dev, legacyBlockSize, inode, legacyInodeTableStart+int64(i)*legacyInodeSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if starts[i] < legacyDataStart {
+			continue
+		}
+		data := make([]byte, sizes[i]*4)
+		for k := range sizes[i] {
+			binary.LittleEndian.PutUint32(data[k*4:], uint32(int64(i)*100000+k))
+		}
+		err = writeBytes(dev, legacyBlockSize, data, starts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	contents := make([][]int32, len(names))
+	for i := range names {
+		if starts[i] < legacyDataStart {
+			continue
+		}
+		data := make([]byte, sizes[i]*4)
+		err = readBytes(dev, legacyBlockSize, data, starts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range sizes[i] {
+			contents[i] = append(contents[i], int32(binary.LittleEndian.Uint32(data[k*4:])))
+		}
+	}
+	return contents
+}
+
+func TestUpgradeFromV1(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "legacy.img")
+
+	names := []string{"a", "b", "c", "d/x", "ruim"}
+	starts := []int64{legacyDataStart, 400 * legacyBlockSize, 401 * legacyBlockSize, 500 * legacyBlockSize, 10}
+	sizes := []int64{3000, 5000, 2000, 10, 10}
+	contents := writeLegacyImage(t, filename, names, starts, sizes)
+
+	_, err := Mount(filename)
+	if err == nil {
+		t.Fatal("Mount deveria recusar uma imagem no layout 1")
+	}
+
+	report, err := Upgrade(filename, true)
+	if err != nil {
+		t.Fatalf("Upgrade (simulação): %v", err)
+	}
+	if report.From != 1 || len(report.Actions) == 0 {
+		t.Fatalf("relatório inesperado: %+v", report)
+	}
+
+	report, err = Upgrade(filename, false)
+	if err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if report.From != 1 || report.To != constants.LayoutVersion {
+		t.Fatalf("relatório inesperado: %+v", report)
+	}
+
+	fsys, err := Mount(filename)
+	if err != nil {
+		t.Fatalf("Mount: %v", err)
+	}
+
+	paths := []string{"a", "b", "c", "d_x~4"}
+	for i, name := range paths {
+		got, err := fsys.ReadFile(name, 0, sizes[i])
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", name, err)
+		}
+		if !slices.Equal(got, contents[i]) {
+			t.Errorf("conteúdo de %s mudou na migração", name)
+		}
+
+		inode, _ := fsys.Lookup(name)
+		if inode.Mode != constants.DefaultFileMode || inode.Ctime == 0 {
+			t.Errorf("%s sem modo ou tempos após a migração: %+v", name, inode)
+		}
+	}
+
+	if _, err := fsys.Lookup("ruim"); err == nil {
+		t.Error("arquivo com dados fora do disco deveria ser descartado")
+	}
+
+	_, err = Upgrade(filename, false)
+	if !errors.Is(err, device.ErrLocked) {
+		t.Fatalf("Upgrade deveria recusar uma imagem montada: %v", err)
+	}
+	err = fsys.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	report, err = Upgrade(filename, false)
+	if err != nil || report.From != report.To {
+		t.Fatalf("segunda migração deveria ser vazia: %+v, %v", report, err)
+	}
+
+	fsck, err := Fsck(filename, false)
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if len(fsck.Problems) > 0 {
+		t.Fatalf("fsck encontrou problemas após a migração: %v", fsck.Problems)
+	}
+}
+
+var errCrash = errors.New("queda simulada")
+
+// crashDevice guarda as gravações em memória, sobre uma imagem que não muda,
+// e falha a partir da gravação de número writes, como se o processo tivesse
+// caído ali. Com writes negativo, nunca falha. As gravações são guardadas por
+// setor porque a migração lê o superbloco com blocos de outro tamanho.
+type crashDevice struct {
+	device.BlockDevice
+	sectors map[int64][]byte
+	writes  int
+}
+
+const crashSector = 512
+
+func (d *crashDevice) ReadBlock(index int64, p []byte) error {
+	return d.ReadBlocks(index, 1, p)
+}
+
+func (d *crashDevice) ReadBlocks(index int64, count int, p []byte) error {
+	err := d.BlockDevice.ReadBlocks(index, count, p)
+	if err != nil {
+		return err
+	}
+	off := index * int64(len(p)/count)
+	for n := 0; n < len(p); n += crashSector {
+		if sector, ok := d.sectors[(off+int64(n))/crashSector]; ok {
+			copy(p[n:], sector)
+		}
+	}
+	return nil
+}
+
+func (d *crashDevice) WriteBlock(index int64, p []byte) error {
+	return d.WriteBlocks(index, 1, p)
+}
+
+func (d *crashDevice) WriteBlocks(index int64, count int, p []byte) error {
+	if d.writes == 0 {
+		return errCrash
+	}
+	d.writes--
+
+	off := index * int64(len(p)/count)
+	for n := 0; n < len(p); n += crashSector {
+		d.sectors[(off+int64(n))/crashSector] = slices.Clone(p[n : n+crashSector])
+	}
+	return nil
+}
+
+func (d *crashDevice) Sync() error {
+	return nil
+}
+
+func TestUpgradeFromV1Interrupted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "legacy.img")
+
+	names := []string{"a", "b", "c", "d"}
+	starts := []int64{legacyDataStart, 400 * legacyBlockSize, 401 * legacyBlockSize, 500 * legacyBlockSize}
+	sizes := []int64{3000, 5000, 2000, 10}
+	contents := writeLegacyImage(t, filename, names, starts, sizes)
+
+	base, err := device.OpenFileDevice(filename, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("OpenFileDevice: %v", err)
+	}
+	defer base.Close()
+
+	legacy, _, err := readLegacyFiles(base)
+	if err != nil {
+		t.Fatalf("readLegacyFiles: %v", err)
+	}
+
+	// Interrompe a migração em cada gravação, até ela terminar sem falhar.
+	resumed := 0
+	for writes := 0; ; writes++ {
+		dev := &crashDevice{BlockDevice: base, sectors: make(map[int64][]byte), writes: writes}
+		_, err := upgrade(dev, false)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errCrash) {
+			t.Fatalf("queda após %d gravações: %v", writes, err)
+		}
+
+		_, staged, err := readStagedUpgrade(dev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if staged {
+			resumed++
+		} else {
+			// Antes da troca do superbloco, a imagem continua no layout 1.
+			files, _, err := readLegacyFiles(dev)
+			if err != nil || !slices.Equal(files, legacy) {
+				t.Fatalf("queda após %d gravações alterou a tabela antiga: %v", writes, err)
+			}
+			for i, file := range files {
+				data := make([]byte, file.size*4)
+				err = readBytes(dev, legacyBlockSize, data, file.extent.Start*legacyBlockSize)
+				if err != nil || !slices.Equal(decodeInts(nil, data), contents[i]) {
+					t.Fatalf("queda após %d gravações alterou os dados de %s: %v", writes, file.name, err)
+				}
+			}
+		}
+
+		dev.writes = -1
+		report, err := upgrade(dev, false)
+		if err != nil || report.To != constants.LayoutVersion {
+			t.Fatalf("migração após queda em %d gravações: %+v, %v", writes, report, err)
+		}
+
+		// A montagem reaplica o journal que a migração deixou pendente.
+		fsys, err := MountDevice(dev)
+		if err != nil {
+			t.Fatalf("MountDevice após queda em %d gravações: %v", writes, err)
+		}
+		for i, name := range names {
+			got, err := fsys.ReadFile(name, 0, sizes[i])
+			if err != nil || !slices.Equal(got, contents[i]) {
+				t.Fatalf("%s mudou após queda em %d gravações: %v", name, writes, err)
+			}
+		}
+	}
+
+	if resumed == 0 {
+		t.Error("nenhuma queda ocorreu depois da troca do superbloco")
+	}
+}
@@ -32,7 +32,7 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhiteSpace()
 
-	if isLetter(l.ch) {
+	if isLetter(l.ch) || isPathSeparator(l.ch) || isOptionPrefix(l.ch) {
 		literal := l.readIdentifier()
 		tok.Type = token.LookupIdent(literal)
 		tok.Literal = literal
@@ -56,7 +56,7 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func (l *Lexer) skipWhiteSpace() {
-	if l.ch == ' ' || l.ch == '\n' || l.ch == '\t' || l.ch == '\r' {
+	for l.ch == ' ' || l.ch == '\n' || l.ch == '\t' || l.ch == '\r' {
 		l.readChar()
 	}
 }
@@ -67,7 +67,7 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) || isPathSeparator(l.ch) || l.ch == '-' || l.ch == '=' {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -85,6 +85,16 @@ func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
+// paths like "docs/../a.txt" are read as a single identifier
+func isPathSeparator(ch byte) bool {
+	return ch == '/' || ch == '.'
+}
+
+// options like "--mem=64M" are read as a single identifier
+func isOptionPrefix(ch byte) bool {
+	return ch == '-'
+}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
@@ -1,23 +1,63 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path"
 	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/Jonaires777/src/constants"
 	"github.com/Jonaires777/src/filemanager"
 	"github.com/Jonaires777/src/lexer"
 	"github.com/Jonaires777/src/token"
 )
 
+// Session guarda o estado que sobrevive entre comandos do REPL.
+// ReadPassword lê uma senha do terminal sem ecoá-la.
+type Session struct {
+	FS           *filemanager.FileSystem
+	Cwd          string
+	ReadPassword func(prompt string) ([]byte, error)
+}
+
+func NewSession(fsys *filemanager.FileSystem) *Session {
+	return &Session{FS: fsys, Cwd: "/"}
+}
+
+// NewPassword pede uma senha nova duas vezes e confere se são iguais.
+func (s *Session) NewPassword(prompt string) (string, error) {
+	if s.ReadPassword == nil {
+		return "", errors.New("não há terminal para ler a senha")
+	}
+
+	password, err := s.ReadPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	confirmation, err := s.ReadPassword("confirme a senha: ")
+	if err != nil {
+		return "", err
+	}
+
+	if string(password) != string(confirmation) {
+		return "", errors.New("as senhas não conferem")
+	}
+	return string(password), nil
+}
+
 type Parser struct {
 	l         *lexer.Lexer
+	session   *Session
 	currToken token.Token
 	peekToken token.Token
 }
 
-func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l}
+func New(l *lexer.Lexer, session *Session) *Parser {
+	p := &Parser{l: l, session: session}
 	p.nextToken()
 	p.nextToken()
 	return p
@@ -28,7 +68,34 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
+func (p *Parser) absPath(name string) string {
+	if path.IsAbs(name) {
+		return path.Clean(name)
+	}
+	return path.Join(p.session.Cwd, name)
+}
+
+// mutatingCommands são os comandos que alteram o disco e por isso são
+// recusados quando ele foi montado só para leitura.
+var mutatingCommands = map[token.TokenType]bool{
+	token.CREATE:   true,
+	token.REMOVE:   true,
+	token.ORDER:    true,
+	token.CONCAT:   true,
+	token.MKDIR:    true,
+	token.RMDIR:    true,
+	token.USERADD:  true,
+	token.GROUPADD: true,
+	token.CHMOD:    true,
+	token.CHOWN:    true,
+	token.IMPORT:   true,
+}
+
 func (p *Parser) ParseCommand() string {
+	if mutatingCommands[p.currToken.Type] && p.session.FS.ReadOnly() {
+		return fmt.Sprintf("Erro: %s não é permitido, o disco foi montado só para leitura", p.currToken.Literal)
+	}
+
 	switch p.currToken.Type {
 	case token.CREATE:
 		return p.parseCreate()
@@ -42,6 +109,39 @@ func (p *Parser) ParseCommand() string {
 		return p.parseRead()
 	case token.CONCAT:
 		return p.parseConcat()
+	case token.MKDIR:
+		return p.parseMkdir()
+	case token.RMDIR:
+		return p.parseRmdir()
+	case token.CD:
+		return p.parseCd()
+	case token.PWD:
+		return p.session.Cwd
+	case token.STAT:
+		return p.parseStat()
+	case token.WHOAMI:
+		user, group := p.session.FS.Whoami()
+		return fmt.Sprintf("%s (grupo %s)", user, group)
+	case token.USERADD:
+		return p.parseUseradd()
+	case token.GROUPADD:
+		return p.parseGroupadd()
+	case token.CHMOD:
+		return p.parseChmod()
+	case token.CHOWN:
+		return p.parseChown()
+	case token.BENCHSORT:
+		return p.parseBenchSort()
+	case token.FIND:
+		return p.parseFind()
+	case token.CACHE:
+		return p.parseCache()
+	case token.SYNC:
+		return p.parseSync()
+	case token.IMPORT:
+		return p.parseImport()
+	case token.EXPORT:
+		return p.parseExport()
 	case token.HELP:
 		return p.parseHelp()
 	default:
@@ -62,7 +162,7 @@ func (p *Parser) parseCreate() string {
 		return "Erro: tamanho do arquivo deve ser um número inteiro"
 	}
 
-	err = filemanager.CreateFile(filename, size)
+	err = p.session.FS.CreateFile(p.absPath(filename), size)
 	if err != nil {
 		return fmt.Sprintf("Erro ao criar o arquivo: %v", err)
 	}
@@ -71,7 +171,13 @@ func (p *Parser) parseCreate() string {
 }
 
 func (p *Parser) parseList() string {
-	files, totalUsed, err := filemanager.ListFiles()
+	dirname := p.session.Cwd
+	p.nextToken()
+	if p.currToken.Type == token.IDENT {
+		dirname = p.absPath(p.currToken.Literal)
+	}
+
+	files, totalUsed, err := p.session.FS.ListFiles(dirname)
 	if err != nil {
 		return fmt.Sprintf("Erro ao listar arquivos: %v", err)
 	}
@@ -82,10 +188,16 @@ func (p *Parser) parseList() string {
 
 	var filesList string
 	for _, file := range files {
-		filesList += fmt.Sprintf("Nome: %s, Tamanho: %d\n", file.Filename, file.Size)
+		user, group := p.session.FS.OwnerNames(file.UID, file.GID)
+		details := fmt.Sprintf("Modo: %s, Dono: %s:%s, Modificado: %s", file.FileMode(), user, group, formatTime(file.Mtime))
+		if file.IsDir() {
+			filesList += fmt.Sprintf("Nome: %s/, Entradas: %d, %s\n", file.Name(), file.Size, details)
+			continue
+		}
+		filesList += fmt.Sprintf("Nome: %s, Tamanho: %d bytes, %s\n", file.Name(), file.Size, details)
 	}
 
-	return fmt.Sprintf("Arquivos:\n%s\nEspaço total usado: %d, Espaço total disponível: %d", filesList, totalUsed, constants.DiskSize-totalUsed)
+	return fmt.Sprintf("Arquivos:\n%s\nEspaço usado no diretório: %d, Espaço livre no disco: %d", filesList, totalUsed, p.session.FS.FreeSpace())
 }
 
 func (p *Parser) parseRemove() string {
@@ -96,7 +208,7 @@ func (p *Parser) parseRemove() string {
 
 	filename := p.currToken.Literal
 
-	err := filemanager.RemoveFile(filename)
+	err := p.session.FS.RemoveFile(p.absPath(filename))
 	if err != nil {
 		return fmt.Sprintf("Erro ao remover o arquivo: %v", err)
 	}
@@ -132,7 +244,7 @@ func (p *Parser) parseRead() string {
 		return "Erro: índice final deve ser um número inteiro"
 	}
 
-	data, err := filemanager.ReadFile(filename, int64(startIdx), int64(endIdx))
+	data, err := p.session.FS.ReadFile(p.absPath(filename), int64(startIdx), int64(endIdx))
 	if err != nil {
 		return fmt.Sprintf("Erro ao ler o arquivo: %v", err)
 	}
@@ -140,6 +252,57 @@ func (p *Parser) parseRead() string {
 	return fmt.Sprintf("Conteúdo do arquivo '%s':\n %v", filename, data)
 }
 
+func (p *Parser) parseFind() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de arquivo após find"
+	}
+
+	filename := p.currToken.Literal
+
+	// Valores negativos chegam como identificadores, por causa do '-'.
+	p.nextToken()
+	value, err := strconv.ParseInt(p.currToken.Literal, 10, 32)
+	if err != nil {
+		return "Erro: esperado um valor inteiro de 32 bits após o nome do arquivo"
+	}
+
+	indexes, binary, err := p.session.FS.FindValue(p.absPath(filename), int32(value))
+	if err != nil {
+		return fmt.Sprintf("Erro ao buscar no arquivo: %v", err)
+	}
+
+	method := "busca linear"
+	if binary {
+		method = "busca binária"
+	}
+	if len(indexes) == 0 {
+		return fmt.Sprintf("Valor %d não encontrado em '%s' (%s)", value, filename, method)
+	}
+	return fmt.Sprintf("Valor %d encontrado em '%s' nos índices (%s):\n %v", value, filename, method, indexes)
+}
+
+func (p *Parser) parseCache() string {
+	stats := p.session.FS.CacheStats()
+	buffers := stats.Buffers
+	return fmt.Sprintf("Cache de metadados:\n  Inodes lidos da memória: %d\n  Cópias do bitmap: %d\n  Consultas de nomes: %d acertos, %d faltas\n  Blocos pendentes: %d (%d gravações no disco)\n"+
+		"Cache de blocos:\n  Ocupação: %d de %d blocos (%d sujos)\n  Leituras: %d acertos, %d faltas\n  Descartes: %d\n  Gravações no disco: %d (%d blocos)",
+		stats.InodeHits, stats.BitmapHits, stats.LookupHits, stats.LookupMisses, stats.DirtyBlocks, stats.Flushes,
+		buffers.Blocks, buffers.Capacity, buffers.Dirty, buffers.Hits, buffers.Misses, buffers.Evictions, buffers.Writes, buffers.WrittenBlocks)
+}
+
+func (p *Parser) parseSync() string {
+	if p.session.FS.ReadOnly() {
+		return "Nada a gravar: o disco foi montado só para leitura"
+	}
+
+	err := p.session.FS.Sync()
+	if err != nil {
+		return fmt.Sprintf("Erro ao sincronizar o disco: %v", err)
+	}
+	return "Dados e metadados gravados no disco"
+}
+
 func (p *Parser) parseOrder() string {
 	p.nextToken()
 	if p.currToken.Type != token.IDENT {
@@ -148,12 +311,133 @@ func (p *Parser) parseOrder() string {
 
 	filename := p.currToken.Literal
 
-	duration, err := filemanager.OrderFile(filename)
+	var opts filemanager.SortOptions
+	for p.peekToken.Type == token.IDENT && !strings.HasPrefix(p.peekToken.Literal, "--") {
+		p.nextToken()
+		switch p.currToken.Literal {
+		case "asc":
+			opts.Descending = false
+		case "desc":
+			opts.Descending = true
+		case "stable":
+			opts.Stable = true
+		default:
+			return fmt.Sprintf("Erro: '%s' inesperado, use asc, desc ou stable", p.currToken.Literal)
+		}
+	}
+
+	options, err := p.parseOptions()
+	if err != nil {
+		return fmt.Sprintf("Erro: %v", err)
+	}
+
+	for name, value := range options {
+		switch name {
+		case "mem":
+			opts.Memory, err = ParseSize(value)
+			if err != nil {
+				return fmt.Sprintf("Erro: %v", err)
+			}
+		case "algo":
+			opts.Algorithm = value
+		case "workers":
+			opts.Workers, err = strconv.Atoi(value)
+			if err != nil || opts.Workers < 0 {
+				return "Erro: --workers deve ser um número inteiro, 0 para usar todas as CPUs"
+			}
+		case "key":
+			opts.Key, err = parseSortKey(value)
+			if err != nil {
+				return fmt.Sprintf("Erro: %v", err)
+			}
+		case "mod":
+			modulus, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || modulus <= 0 {
+				return "Erro: --mod deve ser um número inteiro positivo"
+			}
+			opts.Modulus = int32(modulus)
+		default:
+			return fmt.Sprintf("Erro: opção --%s desconhecida para order", name)
+		}
+	}
+
+	if (opts.Key == filemanager.KeyModulo) != (opts.Modulus != 0) {
+		return "Erro: --key=mod e --mod=<n> devem ser usados juntos"
+	}
+
+	stats, err := p.session.FS.OrderFile(p.absPath(filename), opts)
 	if err != nil {
 		return fmt.Sprintf("Erro ao ordenar o arquivo: %v", err)
 	}
 
-	return fmt.Sprintf("Arquivo '%s' ordenado com sucesso\nTempo em ordenação: %dms", filename, duration)
+	result := fmt.Sprintf("Arquivo '%s' ordenado com sucesso\nAlgoritmo: %s, Comparações: %d, Trocas: %d, E/S: %d bytes\nTempo em ordenação: %dms",
+		filename, stats.Algorithm, stats.Comparisons, stats.Swaps, stats.IOBytes, stats.Elapsed.Milliseconds())
+	if stats.Workers > 1 {
+		result += fmt.Sprintf("\nWorkers: %d, aceleração estimada da ordenação das runs: %.2fx (soma dos tempos das runs / tempo real)", stats.Workers, stats.EstimatedSpeedup())
+	}
+	return result
+}
+
+func parseSortKey(value string) (filemanager.SortKey, error) {
+	switch value {
+	case "value":
+		return filemanager.KeyValue, nil
+	case "abs":
+		return filemanager.KeyAbs, nil
+	case "mod":
+		return filemanager.KeyModulo, nil
+	case "digits":
+		return filemanager.KeyDigitSum, nil
+	default:
+		return 0, fmt.Errorf("chave '%s' desconhecida, use value, abs, mod ou digits", value)
+	}
+}
+
+func (p *Parser) parseBenchSort() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de arquivo após bench-sort"
+	}
+
+	filename := p.currToken.Literal
+
+	options, err := p.parseOptions()
+	if err != nil {
+		return fmt.Sprintf("Erro: %v", err)
+	}
+
+	var memory int64
+	for name, value := range options {
+		switch name {
+		case "mem":
+			memory, err = ParseSize(value)
+			if err != nil {
+				return fmt.Sprintf("Erro: %v", err)
+			}
+		default:
+			return fmt.Sprintf("Erro: opção --%s desconhecida para bench-sort", name)
+		}
+	}
+
+	results, err := p.session.FS.BenchSort(p.absPath(filename), memory)
+	if err != nil {
+		return fmt.Sprintf("Erro ao comparar as ordenações: %v", err)
+	}
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Algoritmo\tComparações\tTrocas\tTempo\tE/S (bytes)")
+	for _, stats := range results {
+		if stats.Skipped {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t(ignorado: quadrático para runs deste tamanho)\n", stats.Algorithm)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2fms\t%d\n", stats.Algorithm, stats.Comparisons, stats.Swaps,
+			float64(stats.Elapsed.Microseconds())/1000, stats.IOBytes)
+	}
+	w.Flush()
+
+	return fmt.Sprintf("Comparação das ordenações de '%s' (o arquivo não é alterado):\n%s", filename, strings.TrimSuffix(table.String(), "\n"))
 }
 
 func (p *Parser) parseConcat() string {
@@ -178,7 +462,7 @@ func (p *Parser) parseConcat() string {
 
 	newFilename := p.currToken.Literal
 
-	err := filemanager.ConcatFiles(filename1, filename2, newFilename)
+	err := p.session.FS.ConcatFiles(p.absPath(filename1), p.absPath(filename2), p.absPath(newFilename))
 	if err != nil {
 		return fmt.Sprintf("Erro ao concatenar os arquivos: %v", err)
 	}
@@ -186,15 +470,355 @@ func (p *Parser) parseConcat() string {
 	return fmt.Sprintf("Arquivos '%s' e '%s' concatenados com sucesso", filename1, filename2)
 }
 
+func (p *Parser) parseMkdir() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de diretório após mkdir"
+	}
+
+	dirname := p.currToken.Literal
+
+	err := p.session.FS.MakeDirectory(p.absPath(dirname))
+	if err != nil {
+		return fmt.Sprintf("Erro ao criar o diretório: %v", err)
+	}
+
+	return fmt.Sprintf("Diretório '%s' criado com sucesso", dirname)
+}
+
+func (p *Parser) parseRmdir() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de diretório após rmdir"
+	}
+
+	dirname := p.currToken.Literal
+
+	err := p.session.FS.RemoveDirectory(p.absPath(dirname))
+	if err != nil {
+		return fmt.Sprintf("Erro ao remover o diretório: %v", err)
+	}
+
+	return fmt.Sprintf("Diretório '%s' removido com sucesso", dirname)
+}
+
+func (p *Parser) parseCd() string {
+	dirname := "/"
+	p.nextToken()
+	if p.currToken.Type == token.IDENT {
+		dirname = p.absPath(p.currToken.Literal)
+	}
+
+	inode, err := p.session.FS.Lookup(dirname)
+	if err != nil {
+		return fmt.Sprintf("Erro ao mudar de diretório: %v", err)
+	}
+	if !inode.IsDir() {
+		return fmt.Sprintf("Erro: '%s' não é um diretório", dirname)
+	}
+
+	p.session.Cwd = dirname
+	return p.session.Cwd
+}
+
+func (p *Parser) parseStat() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de arquivo após stat"
+	}
+
+	filename := p.absPath(p.currToken.Literal)
+
+	inode, err := p.session.FS.Lookup(filename)
+	if err != nil {
+		return fmt.Sprintf("Erro ao consultar o arquivo: %v", err)
+	}
+
+	kind, size := "arquivo", fmt.Sprintf("Tamanho: %d bytes", inode.Size)
+	if inode.IsDir() {
+		kind, size = "diretório", fmt.Sprintf("Entradas: %d", inode.Size)
+	}
+
+	switch {
+	case inode.Flags&filemanager.FlagSortedAsc != 0:
+		size += "\nOrdenado: crescente"
+	case inode.Flags&filemanager.FlagSortedDesc != 0:
+		size += "\nOrdenado: decrescente"
+	}
+
+	user, group := p.session.FS.OwnerNames(inode.UID, inode.GID)
+
+	return fmt.Sprintf("Arquivo: %s\nTipo: %s\n%s\nModo: %s (%04o)\nDono: %s (uid %d), grupo %s (gid %d)\nCriação: %s\nModificação: %s\nAcesso: %s",
+		filename, kind, size, inode.FileMode(), inode.Mode, user, inode.UID, group, inode.GID,
+		formatTime(inode.Ctime), formatTime(inode.Mtime), formatTime(inode.Atime))
+}
+
+func (p *Parser) parseUseradd() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de usuário após useradd"
+	}
+	name := p.currToken.Literal
+
+	group := ""
+	noPassword := false
+	for p.peekToken.Type == token.IDENT {
+		p.nextToken()
+		if p.currToken.Literal == "--no-password" {
+			noPassword = true
+		} else if group == "" {
+			group = p.currToken.Literal
+		} else {
+			return fmt.Sprintf("Erro: argumento inesperado '%s'", p.currToken.Literal)
+		}
+	}
+
+	password := ""
+	if !noPassword {
+		var err error
+		password, err = p.session.NewPassword(fmt.Sprintf("senha de %s: ", name))
+		if err != nil {
+			return fmt.Sprintf("Erro ao criar o usuário: %v", err)
+		}
+	}
+
+	err := p.session.FS.AddUser(name, group, password, noPassword)
+	if err != nil {
+		return fmt.Sprintf("Erro ao criar o usuário: %v", err)
+	}
+
+	return fmt.Sprintf("Usuário '%s' criado com sucesso", name)
+}
+
+func (p *Parser) parseGroupadd() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de grupo após groupadd"
+	}
+	name := p.currToken.Literal
+
+	err := p.session.FS.AddGroup(name)
+	if err != nil {
+		return fmt.Sprintf("Erro ao criar o grupo: %v", err)
+	}
+
+	return fmt.Sprintf("Grupo '%s' criado com sucesso", name)
+}
+
+func (p *Parser) parseChmod() string {
+	p.nextToken()
+	if p.currToken.Type != token.INT {
+		return "Erro: esperado um modo octal após chmod"
+	}
+
+	mode, err := strconv.ParseUint(p.currToken.Literal, 8, 32)
+	if err != nil {
+		return "Erro: modo deve ser um número octal, como 644"
+	}
+
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de arquivo após o modo"
+	}
+	filename := p.currToken.Literal
+
+	err = p.session.FS.Chmod(p.absPath(filename), uint32(mode))
+	if err != nil {
+		return fmt.Sprintf("Erro ao alterar o modo: %v", err)
+	}
+
+	return fmt.Sprintf("Modo de '%s' alterado para %04o", filename, mode)
+}
+
+// parseChown aceita "chown <usuário> <arquivo>" e "chown <usuário> <grupo> <arquivo>".
+func (p *Parser) parseChown() string {
+	var args []string
+	for p.nextToken(); p.currToken.Type == token.IDENT; p.nextToken() {
+		args = append(args, p.currToken.Literal)
+	}
+
+	var user, group, filename string
+	switch len(args) {
+	case 2:
+		user, filename = args[0], args[1]
+	case 3:
+		user, group, filename = args[0], args[1], args[2]
+	default:
+		return "Erro: use chown <usuário> [grupo] <arquivo>"
+	}
+
+	err := p.session.FS.Chown(p.absPath(filename), user, group)
+	if err != nil {
+		return fmt.Sprintf("Erro ao alterar o dono: %v", err)
+	}
+
+	return fmt.Sprintf("Dono de '%s' alterado com sucesso", filename)
+}
+
+// parseFormat lê o formato opcional de import e export; o padrão é raw.
+func (p *Parser) parseFormat() (filemanager.TransferFormat, error) {
+	p.nextToken()
+	switch p.currToken.Literal {
+	case "", "raw":
+		return filemanager.FormatRaw, nil
+	case "text":
+		return filemanager.FormatText, nil
+	default:
+		return 0, fmt.Errorf("formato '%s' desconhecido, use raw ou text", p.currToken.Literal)
+	}
+}
+
+func (p *Parser) parseImport() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um caminho do host após import"
+	}
+	hostPath := p.currToken.Literal
+
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de arquivo após o caminho do host"
+	}
+	filename := p.currToken.Literal
+
+	format, err := p.parseFormat()
+	if err != nil {
+		return fmt.Sprintf("Erro: %v", err)
+	}
+
+	hostFile, err := os.Open(hostPath)
+	if err != nil {
+		return fmt.Sprintf("Erro ao abrir o arquivo do host: %v", err)
+	}
+	defer hostFile.Close()
+
+	size, err := p.session.FS.Import(p.absPath(filename), hostFile, format)
+	if err != nil {
+		return fmt.Sprintf("Erro ao importar o arquivo: %v", err)
+	}
+
+	return fmt.Sprintf("Arquivo '%s' importado para '%s': %d bytes", hostPath, filename, size)
+}
+
+func (p *Parser) parseExport() string {
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um nome de arquivo após export"
+	}
+	filename := p.currToken.Literal
+
+	p.nextToken()
+	if p.currToken.Type != token.IDENT {
+		return "Erro: esperado um caminho do host após o nome do arquivo"
+	}
+	hostPath := p.currToken.Literal
+
+	format, err := p.parseFormat()
+	if err != nil {
+		return fmt.Sprintf("Erro: %v", err)
+	}
+
+	hostFile, err := os.Create(hostPath)
+	if err != nil {
+		return fmt.Sprintf("Erro ao criar o arquivo do host: %v", err)
+	}
+
+	size, err := p.session.FS.Export(p.absPath(filename), hostFile, format)
+	if err != nil {
+		hostFile.Close()
+		os.Remove(hostPath)
+		return fmt.Sprintf("Erro ao exportar o arquivo: %v", err)
+	}
+
+	err = hostFile.Close()
+	if err != nil {
+		return fmt.Sprintf("Erro ao gravar o arquivo do host: %v", err)
+	}
+
+	return fmt.Sprintf("Arquivo '%s' exportado para '%s': %d bytes", filename, hostPath, size)
+}
+
+// parseOptions consome as opções no formato --nome=valor que vêm a seguir.
+func (p *Parser) parseOptions() (map[string]string, error) {
+	options := make(map[string]string)
+	for p.peekToken.Type == token.IDENT && strings.HasPrefix(p.peekToken.Literal, "--") {
+		p.nextToken()
+		name, value, ok := strings.Cut(strings.TrimPrefix(p.currToken.Literal, "--"), "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("opção '%s' sem valor, use --%s=<valor>", p.currToken.Literal, name)
+		}
+		options[name] = value
+	}
+	return options, nil
+}
+
+// ParseSize interpreta tamanhos como 512, 64K, 16M ou 1G.
+func ParseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("tamanho inválido: %q", value)
+	}
+
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1024
+	case "M":
+		multiplier = 1024 * 1024
+	case "G":
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("tamanho inválido: %s", value)
+	}
+	return n * multiplier, nil
+}
+
+func formatTime(nanos int64) string {
+	return time.Unix(0, nanos).Format("2006-01-02 15:04:05")
+}
+
 func (p *Parser) parseHelp() string {
 	return `
 Use os seguintes comandos para interagir com o sistema de arquivos:
 create <filename> <size> - criar um novo arquivo com o tamanho fornecido
 remove <filename> - remover um arquivo
-list - listar todos os arquivos
-order <filename> - ordenar um arquivo
+order <filename> [asc|desc] [stable] [--key=<key>] [--mod=<n>] [--algo=<algo>] [--mem=<size>] [--workers=<n>] - ordenar um arquivo
+    usando no máximo a memória indicada (padrão 16M) e n goroutines (padrão e 0: todas as CPUs)
+    chaves: value (padrão), abs, mod (resto da divisão por --mod), digits (soma dos dígitos)
+    stable mantém a ordem original das chaves iguais e exige merge, radix ou insertion
+    algoritmos: quick (padrão), merge, heap, radix, insertion, shell
+bench-sort <filename> [--mem=<size>] - comparar os algoritmos de ordenação sem alterar o arquivo
+    com o disco montado só para leitura, ordena em memória e o arquivo precisa caber em --mem
 read <filename> <startIdx> <endIdx> - ler um arquivo
+find <filename> <value> - listar os índices de um valor, com busca binária se o arquivo estiver ordenado
 concat <filename1> <filename2> <newFile> - concatenar dois arquivos em um novo arquivo
+mkdir <dirname> - criar um diretório
+rmdir <dirname> - remover um diretório vazio
+cd [dirname] - mudar o diretório atual
+pwd - mostrar o diretório atual
+list [dirname] - listar o conteúdo de um diretório
+stat <filename> - mostrar tamanho, modo, dono e datas de um arquivo
+chmod <mode> <filename> - alterar as permissões de um arquivo (modo octal)
+chown <user> [group] <filename> - alterar o dono de um arquivo (apenas root)
+useradd <user> [group] [--no-password] - criar um usuário (apenas root), pedindo a sua senha;
+    --no-password permite que ele entre sem senha
+groupadd <group> - criar um grupo (apenas root)
+import <hostpath> <filename> [raw|text] - copiar um arquivo do host para o disco
+export <filename> <hostpath> [raw|text] - copiar um arquivo do disco para o host
+login [user] - entrar com outro usuário; no primeiro login, o usuário define a sua senha
+passwd [--no-password] - alterar a senha do usuário atual, ou removê-la com --no-password
+whoami - mostrar o usuário atual
+cache - mostrar as estatísticas do cache de metadados e do cache de blocos
+sync - gravar no disco os dados e metadados pendentes
 exit - sair do programa
+
+Com o disco montado só para leitura (jwfs -read-only), os comandos que o
+alteram são recusados: create, remove, order, concat, mkdir, rmdir, chmod,
+chown, useradd, groupadd, import e passwd.
 `
 }
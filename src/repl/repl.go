@@ -1,18 +1,20 @@
 package repl
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"strings"
 
 	"github.com/chzyer/readline"
 
+	"github.com/Jonaires777/src/filemanager"
 	"github.com/Jonaires777/src/lexer"
 	"github.com/Jonaires777/src/parser"
 )
 
 const prompt = `jwfs>> `
 
-func Start() {
+func Start(fsys *filemanager.FileSystem) {
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:                 prompt,
 		HistoryFile:            "/tmp/readline.tmp",
@@ -24,6 +26,21 @@ func Start() {
 
 	defer rl.Close()
 
+	session := parser.NewSession(fsys)
+	session.ReadPassword = rl.ReadPassword
+
+	// Nenhum comando é aceito antes de um login válido.
+	for {
+		err := login(rl, session, "")
+		if err == nil {
+			break
+		}
+		if errors.Is(err, readline.ErrInterrupt) || err.Error() == "EOF" {
+			return
+		}
+		fmt.Println("Erro:", err)
+	}
+
 	for {
 		line, err := rl.Readline()
 		if err != nil {
@@ -35,14 +52,102 @@ func Start() {
 		}
 
 		if line == "exit" {
-			os.Exit(0)
+			return
+		}
+
+		// login e passwd leem senhas do terminal, então não passam pelo parser.
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "login":
+			name := ""
+			if len(fields) > 1 {
+				name = fields[1]
+			}
+			if err := login(rl, session, name); err != nil {
+				fmt.Println("Erro:", err)
+			}
+			continue
+		case "passwd":
+			if err := passwd(session, fields[1:]); err != nil {
+				fmt.Println("Erro:", err)
+			}
+			continue
 		}
 
 		l := lexer.New(line)
-		p := parser.New(l)
+		p := parser.New(l, session)
 
 		program := p.ParseCommand()
 
 		fmt.Println(program)
 	}
 }
+
+// login pede o nome, se não foi informado, e sempre a senha, mesmo de quem não
+// tem uma, para não revelar quais usuários existem. Um usuário que nunca teve
+// senha, como o root de um disco novo, define a sua.
+func login(rl *readline.Instance, session *parser.Session, name string) error {
+	fsys := session.FS
+
+	if name == "" {
+		rl.SetPrompt("login: ")
+		line, err := rl.Readline()
+		rl.SetPrompt(prompt)
+		if err != nil {
+			return err
+		}
+		name = strings.TrimSpace(line)
+	}
+
+	input, err := rl.ReadPassword("senha: ")
+	if err != nil {
+		return err
+	}
+	password := string(input)
+
+	err = fsys.Login(name, password)
+	if errors.Is(err, filemanager.ErrNoPassword) {
+		fmt.Printf("Primeiro login de %s: defina uma senha\n", name)
+		password, err = session.NewPassword("nova senha: ")
+		if err != nil {
+			return err
+		}
+		err = fsys.SetInitialPassword(name, password)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Conectado como %s\n", name)
+	return nil
+}
+
+// passwd troca a senha do usuário atual; com --no-password, remove a senha.
+func passwd(session *parser.Session, args []string) error {
+	fsys := session.FS
+	if fsys.ReadOnly() {
+		return filemanager.ErrReadOnly
+	}
+
+	if len(args) > 0 && args[0] == "--no-password" {
+		err := fsys.SetPassword("", true)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Senha removida, o usuário entra sem senha")
+		return nil
+	}
+
+	password, err := session.NewPassword("nova senha: ")
+	if err != nil {
+		return err
+	}
+
+	err = fsys.SetPassword(password, false)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Senha alterada com sucesso")
+	return nil
+}
@@ -16,23 +16,55 @@ const (
 	NEWLINE   = "\n"
 
 	// Commands
-	CREATE = "CREATE"
-	REMOVE = "REMOVE"
-	LIST   = "LIST"
-	ORDER  = "ORDER"
-	READ   = "READ"
-	CONCAT = "CONCAT"
-	HELP   = "HELP"
+	CREATE    = "CREATE"
+	REMOVE    = "REMOVE"
+	LIST      = "LIST"
+	ORDER     = "ORDER"
+	READ      = "READ"
+	CONCAT    = "CONCAT"
+	HELP      = "HELP"
+	MKDIR     = "MKDIR"
+	RMDIR     = "RMDIR"
+	CD        = "CD"
+	PWD       = "PWD"
+	STAT      = "STAT"
+	WHOAMI    = "WHOAMI"
+	USERADD   = "USERADD"
+	GROUPADD  = "GROUPADD"
+	CHMOD     = "CHMOD"
+	CHOWN     = "CHOWN"
+	IMPORT    = "IMPORT"
+	EXPORT    = "EXPORT"
+	BENCHSORT = "BENCHSORT"
+	FIND      = "FIND"
+	CACHE     = "CACHE"
+	SYNC      = "SYNC"
 )
 
 var keywords = map[string]TokenType{
-	"create": CREATE,
-	"remove": REMOVE,
-	"list":   LIST,
-	"order":  ORDER,
-	"read":   READ,
-	"concat": CONCAT,
-	"help":   HELP,
+	"create":     CREATE,
+	"remove":     REMOVE,
+	"list":       LIST,
+	"order":      ORDER,
+	"read":       READ,
+	"concat":     CONCAT,
+	"help":       HELP,
+	"mkdir":      MKDIR,
+	"rmdir":      RMDIR,
+	"cd":         CD,
+	"pwd":        PWD,
+	"stat":       STAT,
+	"whoami":     WHOAMI,
+	"useradd":    USERADD,
+	"groupadd":   GROUPADD,
+	"chmod":      CHMOD,
+	"chown":      CHOWN,
+	"import":     IMPORT,
+	"export":     EXPORT,
+	"bench-sort": BENCHSORT,
+	"find":       FIND,
+	"cache":      CACHE,
+	"sync":       SYNC,
 }
 
 type TokenType string